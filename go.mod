@@ -3,9 +3,11 @@ module github.com/takutakahashi/gtc
 go 1.15
 
 require (
+	github.com/ProtonMail/go-crypto v0.0.0-20210428141323-04723f9f07d7
 	github.com/go-git/go-git/v5 v5.4.2
 	github.com/google/go-cmp v0.3.0
 	github.com/pkg/errors v0.9.1
+	github.com/sergi/go-diff v1.1.0
 	github.com/sirupsen/logrus v1.8.1
 	golang.org/x/crypto v0.0.0-20220826181053-bd7e27e6170d
 	golang.org/x/net v0.0.0-20220826154423-83b083e8dc8b // indirect
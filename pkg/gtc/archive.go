@@ -0,0 +1,424 @@
+package gtc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveTar   ArchiveFormat = "tar"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveZip   ArchiveFormat = "zip"
+)
+
+type ArchiveOpt struct {
+	// Format defaults to tar.
+	Format ArchiveFormat
+	// Prefix is prepended to every path as is, so a directory prefix needs a trailing slash.
+	Prefix string
+	// Paths limits the archive to these files or directories. Each of them must exist.
+	Paths []string
+	// Submodules archives the contents of initialized submodules recursively
+	// instead of an empty directory.
+	Submodules bool
+}
+
+// archiver writes entries of one archive format. Modes follow git archive with tar.umask 002.
+type archiver interface {
+	dir(name string) error
+	file(name string, mode filemode.FileMode, size int64, r io.Reader) error
+	close() error
+}
+
+// Archive writes the tree of rev to w like git archive, honouring export-ignore attributes.
+func (c *Client) Archive(w io.Writer, rev string, opt ArchiveOpt) error {
+	commit, err := c.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	// like git archive, pathspecs are checked before anything is written
+	for _, p := range opt.Paths {
+		ok, err := archivePathExists(c.r, tree, path.Clean(p), opt.Submodules)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("pathspec '%s' did not match any files", p)
+		}
+	}
+	var a archiver
+	switch opt.Format {
+	case "", ArchiveTar:
+		a, err = newTarArchiver(w, commit, false)
+	case ArchiveTarGz:
+		a, err = newTarArchiver(w, commit, true)
+	case ArchiveZip:
+		a, err = newZipArchiver(w, commit)
+	default:
+		return errors.Errorf("unknown archive format %s", opt.Format)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := c.infoAttributes()
+	if err != nil {
+		return err
+	}
+	aw := &archiveWalker{c: c, a: a, opt: opt, info: info}
+	if strings.HasSuffix(opt.Prefix, "/") {
+		if err := a.dir(opt.Prefix); err != nil {
+			return err
+		}
+	}
+	if err := aw.walk(c.r, "", tree, "", nil); err != nil {
+		return err
+	}
+	return a.close()
+}
+
+// archivePathExists reports whether p is in tree of r, looking into the submodules
+// when they are archived too.
+func archivePathExists(r *git.Repository, tree *object.Tree, p string, submodules bool) (bool, error) {
+	if p == "." {
+		return true, nil
+	}
+	if _, err := tree.FindEntry(p); err == nil {
+		return true, nil
+	}
+	if !submodules {
+		return false, nil
+	}
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		e, err := tree.FindEntry(dir)
+		if err != nil {
+			return false, nil
+		}
+		if e.Mode != filemode.Submodule {
+			continue
+		}
+		sr, err := submoduleRepository(r, dir)
+		if err != nil {
+			return false, err
+		}
+		commit, err := sr.CommitObject(e.Hash)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to find commit %s of submodule %s", e.Hash, dir)
+		}
+		sub, err := commit.Tree()
+		if err != nil {
+			return false, err
+		}
+		return archivePathExists(sr, sub, strings.Join(parts[i:], "/"), submodules)
+	}
+	return false, nil
+}
+
+type archiveWalker struct {
+	c   *Client
+	a   archiver
+	opt ArchiveOpt
+	// info are the patterns of $GIT_DIR/info/attributes, which win over the trees.
+	info []gitattributes.MatchAttribute
+}
+
+// walk writes the entries of tree at dir of the repository r checked out at root.
+// attrs are the gitattributes patterns of the parent trees.
+func (aw *archiveWalker) walk(r *git.Repository, root string, tree *object.Tree, dir string, attrs []gitattributes.MatchAttribute) error {
+	attrs, err := treeAttributes(tree, dir, attrs)
+	if err != nil {
+		return err
+	}
+	effective := attrs
+	if r == aw.c.r {
+		effective = append(attrs[:len(attrs):len(attrs)], aw.info...)
+	}
+	for _, e := range tree.Entries {
+		p := path.Join(dir, e.Name)
+		if !aw.selected(p, e.Mode == filemode.Dir || e.Mode == filemode.Submodule) || exportIgnored(effective, p) {
+			continue
+		}
+		name := aw.opt.Prefix + p
+		switch e.Mode {
+		case filemode.Dir:
+			sub, err := tree.Tree(e.Name)
+			if err != nil {
+				return err
+			}
+			if err := aw.a.dir(name + "/"); err != nil {
+				return err
+			}
+			if err := aw.walk(r, root, sub, p, attrs); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			if err := aw.a.dir(name + "/"); err != nil {
+				return err
+			}
+			if !aw.opt.Submodules {
+				continue
+			}
+			sr, err := submoduleRepository(r, strings.TrimPrefix(p, root+"/"))
+			if err != nil {
+				return err
+			}
+			commit, err := sr.CommitObject(e.Hash)
+			if err != nil {
+				return errors.Wrapf(err, "failed to find commit %s of submodule %s", e.Hash, p)
+			}
+			sub, err := commit.Tree()
+			if err != nil {
+				return err
+			}
+			if err := aw.walk(sr, p, sub, p, nil); err != nil {
+				return err
+			}
+		default:
+			blob, err := object.GetBlob(r.Storer, e.Hash)
+			if err != nil {
+				return err
+			}
+			br, err := blob.Reader()
+			if err != nil {
+				return err
+			}
+			err = aw.a.file(name, e.Mode, blob.Size, br)
+			br.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selected reports whether p is under opt.Paths, or is a directory leading to one of them.
+func (aw *archiveWalker) selected(p string, dir bool) bool {
+	if len(aw.opt.Paths) == 0 {
+		return true
+	}
+	ok := false
+	for _, s := range aw.opt.Paths {
+		s = path.Clean(s)
+		if s == "." || p == s || strings.HasPrefix(p, s+"/") {
+			ok = true
+		} else if dir && strings.HasPrefix(s, p+"/") {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// submoduleRepository opens the initialized submodule of r at path p.
+func submoduleRepository(r *git.Repository, p string) (*git.Repository, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range submodules {
+		if sub.Config().Path != p {
+			continue
+		}
+		sr, err := sub.Repository()
+		if err != nil {
+			return nil, errors.Wrapf(err, "submodule %s is not initialized", p)
+		}
+		return sr, nil
+	}
+	return nil, errors.Errorf("submodule %s is not found in %s", p, gitmodulesFile)
+}
+
+func (c *Client) infoAttributes() ([]gitattributes.MatchAttribute, error) {
+	f, err := os.Open(filepath.Join(c.opt.DirPath, ".git", "info", "attributes"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	patterns, err := gitattributes.ReadAttributes(f, nil, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse info/attributes")
+	}
+	return patterns, nil
+}
+
+// treeAttributes appends the patterns of the .gitattributes file in tree, if any.
+func treeAttributes(tree *object.Tree, dir string, attrs []gitattributes.MatchAttribute) ([]gitattributes.MatchAttribute, error) {
+	f, err := tree.File(".gitattributes")
+	if err == object.ErrFileNotFound {
+		return attrs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var domain []string
+	if dir != "" {
+		domain = strings.Split(dir, "/")
+	}
+	patterns, err := gitattributes.ReadAttributes(r, domain, dir == "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path.Join(dir, ".gitattributes"))
+	}
+	return append(attrs[:len(attrs):len(attrs)], patterns...), nil
+}
+
+// exportIgnored reports whether the last pattern deciding export-ignore for p sets it.
+func exportIgnored(attrs []gitattributes.MatchAttribute, p string) bool {
+	ignored := false
+	segments := strings.Split(p, "/")
+	for _, a := range attrs {
+		if a.Pattern == nil || !a.Pattern.Match(segments) {
+			continue
+		}
+		for _, attr := range a.Attributes {
+			if attr.Name() == "export-ignore" {
+				ignored = attr.IsSet()
+			}
+		}
+	}
+	return ignored
+}
+
+type tarArchiver struct {
+	tw    *tar.Writer
+	gz    *gzip.Writer
+	mtime time.Time
+}
+
+func newTarArchiver(w io.Writer, commit *object.Commit, compress bool) (*tarArchiver, error) {
+	a := &tarArchiver{mtime: commit.Committer.When}
+	if compress {
+		a.gz = gzip.NewWriter(w)
+		w = a.gz
+	}
+	a.tw = tar.NewWriter(w)
+	// git archive records the commit in a pax global header.
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": commit.Hash.String()},
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *tarArchiver) header(name string, typ byte, mode int64) *tar.Header {
+	return &tar.Header{Typeflag: typ, Name: name, Mode: mode, ModTime: a.mtime, Uname: "root", Gname: "root"}
+}
+
+func (a *tarArchiver) dir(name string) error {
+	return a.tw.WriteHeader(a.header(name, tar.TypeDir, 0775))
+}
+
+func (a *tarArchiver) file(name string, mode filemode.FileMode, size int64, r io.Reader) error {
+	switch mode {
+	case filemode.Symlink:
+		target, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		h := a.header(name, tar.TypeSymlink, 0777)
+		h.Linkname = string(target)
+		return a.tw.WriteHeader(h)
+	case filemode.Executable:
+		h := a.header(name, tar.TypeReg, 0775)
+		h.Size = size
+		if err := a.tw.WriteHeader(h); err != nil {
+			return err
+		}
+	default:
+		h := a.header(name, tar.TypeReg, 0664)
+		h.Size = size
+		if err := a.tw.WriteHeader(h); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchiver) close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+	return nil
+}
+
+type zipArchiver struct {
+	zw    *zip.Writer
+	mtime time.Time
+}
+
+func newZipArchiver(w io.Writer, commit *object.Commit) (*zipArchiver, error) {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(commit.Hash.String()); err != nil {
+		return nil, err
+	}
+	return &zipArchiver{zw: zw, mtime: commit.Committer.When}, nil
+}
+
+func (a *zipArchiver) dir(name string) error {
+	// 0x10 is the MS-DOS directory attribute git archive uses.
+	_, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: a.mtime, ExternalAttrs: 0x10})
+	return err
+}
+
+func (a *zipArchiver) file(name string, mode filemode.FileMode, size int64, r io.Reader) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.mtime}
+	// Only executables and symlinks carry unix modes, as git archive does.
+	switch mode {
+	case filemode.Executable:
+		h.CreatorVersion = 3 << 8
+		h.ExternalAttrs = 0100755 << 16
+	case filemode.Symlink:
+		h.CreatorVersion = 3 << 8
+		h.ExternalAttrs = 0120777 << 16
+		h.Method = zip.Store
+	}
+	fw, err := a.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (a *zipArchiver) close() error {
+	return a.zw.Close()
+}
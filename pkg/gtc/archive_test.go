@@ -0,0 +1,168 @@
+package gtc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func mockForArchive() Client {
+	c := mockInit()
+	os.MkdirAll(filepath.Join(c.opt.DirPath, "dir", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "dir", "sub", "skip"), []byte{1}, 0644)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "dir", "sub", "keep"), bytes.Repeat([]byte("keep"), 100), 0644)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "secret"), []byte{2}, 0644)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, ".gitattributes"), []byte("secret export-ignore\nsub/skip export-ignore\n"), 0644)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "dir", ".gitattributes"), []byte("sub/skip export-ignore\n"), 0644)
+	os.Symlink("dir/dir_file", filepath.Join(c.opt.DirPath, "link"))
+	c.gitExec([]string{"add", "-A"})
+	c.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "commit", "-m", "archive"})
+	return c
+}
+
+// archiveEntries lists the entries of a tar or zip archive in a comparable form.
+func archiveEntries(t *testing.T, format ArchiveFormat, b []byte) []string {
+	ret := []string{}
+	if format == ArchiveZip {
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, "comment "+zr.Comment)
+		for _, f := range zr.File {
+			r, _ := f.Open()
+			content, _ := ioutil.ReadAll(r)
+			r.Close()
+			ret = append(ret, fmt.Sprintf("%s %v %d %q", f.Name, f.Mode(), f.Modified.Unix(), content))
+		}
+		return ret
+	}
+	var r io.Reader = bytes.NewReader(b)
+	if format == ArchiveTarGz {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return ret
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		ret = append(ret, fmt.Sprintf("%s %c %o %q %d %s/%s %v %q", h.Name, h.Typeflag, h.Mode, h.Linkname, h.ModTime.Unix(), h.Uname, h.Gname, h.PAXRecords, content))
+	}
+}
+
+func TestClient_Archive(t *testing.T) {
+	c := mockForArchive()
+	tests := []struct {
+		name    string
+		opt     ArchiveOpt
+		info    string
+		wantErr bool
+	}{
+		{name: "tar", opt: ArchiveOpt{}},
+		{name: "tar_gz_prefix", opt: ArchiveOpt{Format: ArchiveTarGz, Prefix: "snapshot/"}},
+		{name: "zip", opt: ArchiveOpt{Format: ArchiveZip}},
+		{name: "paths", opt: ArchiveOpt{Prefix: "p-", Paths: []string{"dir/sub", "link"}}},
+		{name: "zip_paths", opt: ArchiveOpt{Format: ArchiveZip, Prefix: "a/b/", Paths: []string{"run.sh", "dir/"}}},
+		{name: "info_attributes", opt: ArchiveOpt{}, info: "file export-ignore\nsecret -export-ignore\n"},
+		{name: "unknown_path", opt: ArchiveOpt{Paths: []string{"none"}}, wantErr: true},
+		{name: "unknown_path_after_match", opt: ArchiveOpt{Paths: []string{"run.sh", "dir/none"}}, wantErr: true},
+		{name: "unknown_format", opt: ArchiveOpt{Format: "rar"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.info != "" {
+				p := filepath.Join(c.opt.DirPath, ".git", "info", "attributes")
+				os.MkdirAll(filepath.Dir(p), 0755)
+				ioutil.WriteFile(p, []byte(tt.info), 0644)
+				defer os.Remove(p)
+			}
+			var buf bytes.Buffer
+			err := c.Archive(&buf, "master", tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Archive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if buf.Len() > 0 {
+					t.Errorf("Client.Archive() wrote %d bytes before failing", buf.Len())
+				}
+				return
+			}
+			format := tt.opt.Format
+			if format == "" {
+				format = ArchiveTar
+			}
+			args := []string{"archive", "--format=" + string(format), "--prefix=" + tt.opt.Prefix, "master"}
+			out, err := c.gitExec(append(args, tt.opt.Paths...))
+			if err != nil {
+				t.Fatalf("git archive: %v", out)
+			}
+			got := archiveEntries(t, format, buf.Bytes())
+			want := archiveEntries(t, format, []byte(strings.Join(out, "\n")))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Client.Archive() = \n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestClient_Archive_submodules(t *testing.T) {
+	c := mockWithNestedSubmodule()
+	c.Commit("add mid")
+	if _, err := c.SubmoduleUpdateWith(SubmoduleUpdateOpt{Depth: -1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opt  ArchiveOpt
+		want []string
+	}{
+		{name: "empty_directory", opt: ArchiveOpt{Paths: []string{"mid"}}, want: []string{"mid/"}},
+		{name: "recursive", opt: ArchiveOpt{Paths: []string{"mid"}, Submodules: true}, want: []string{
+			"mid/", "mid/.gitmodules", "mid/dir/", "mid/dir/dir_file", "mid/file", "mid/leaf/", "mid/leaf/dir/", "mid/leaf/dir/dir_file", "mid/leaf/file",
+		}},
+		{name: "inside_submodule", opt: ArchiveOpt{Paths: []string{"mid/leaf/file"}, Submodules: true}, want: []string{"mid/", "mid/leaf/", "mid/leaf/file"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := c.Archive(&buf, "HEAD", tt.opt); err != nil {
+				t.Fatalf("Client.Archive() error = %v", err)
+			}
+			got := []string{}
+			tr := tar.NewReader(&buf)
+			for {
+				h, err := tr.Next()
+				if err != nil {
+					break
+				}
+				if h.Typeflag != tar.TypeXGlobalHeader {
+					got = append(got, h.Name)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Archive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package gtc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	"github.com/pkg/errors"
+)
+
+type BundleOpt struct {
+	// Refs are the branches, tags or HEAD to bundle.
+	Refs []string
+	// Basis are revisions the receiver already has. Their boundary commits become prerequisites.
+	Basis []string
+	// Version is 2 or 3. Zero means 2.
+	Version int
+}
+
+type FetchBundleOpt struct {
+	// Force overwrites local tags pointing at other objects.
+	Force bool
+}
+
+// BundleRef is a ref of a bundle. For a prerequisite, Name is the subject of the commit.
+type BundleRef struct {
+	Name string `json:"name" yaml:"name"`
+	Hash string `json:"hash" yaml:"hash"`
+}
+
+// Bundle is the header of a git bundle file.
+type Bundle struct {
+	Version       int         `json:"version" yaml:"version"`
+	Prerequisites []BundleRef `json:"prerequisites" yaml:"prerequisites"`
+	Refs          []BundleRef `json:"refs" yaml:"refs"`
+}
+
+// CreateBundle writes a v2 bundle of refs to w like git bundle create. Commits reachable
+// from basis are left out and the boundary commits are recorded as prerequisites.
+func (c *Client) CreateBundle(w io.Writer, refs, basis []string) error {
+	return c.CreateBundleWith(w, BundleOpt{Refs: refs, Basis: basis})
+}
+
+func (c *Client) CreateBundleWith(w io.Writer, opt BundleOpt) error {
+	if opt.Version == 0 {
+		opt.Version = 2
+	}
+	if opt.Version != 2 && opt.Version != 3 {
+		return errors.Errorf("unsupported bundle version %d", opt.Version)
+	}
+	if len(opt.Refs) == 0 {
+		return errors.New("no refs to bundle")
+	}
+	b := Bundle{Version: opt.Version}
+	wants := []plumbing.Hash{}
+	for _, name := range opt.Refs {
+		ref, err := c.bundleRef(name)
+		if err != nil {
+			return err
+		}
+		b.Refs = append(b.Refs, BundleRef{Name: ref.Name().String(), Hash: ref.Hash().String()})
+		wants = append(wants, ref.Hash())
+	}
+	haves := []plumbing.Hash{}
+	excluded := map[plumbing.Hash]bool{}
+	for _, rev := range opt.Basis {
+		commit, err := c.resolveCommit(rev)
+		if err != nil {
+			return err
+		}
+		seen, err := ancestors(commit)
+		if err != nil {
+			return err
+		}
+		for h := range seen {
+			excluded[h] = true
+		}
+		haves = append(haves, commit.Hash)
+	}
+	prerequisites, empty, err := c.bundleBoundary(wants, excluded)
+	if err != nil {
+		return err
+	}
+	if empty {
+		return errors.New("refusing to create empty bundle")
+	}
+	for _, commit := range prerequisites {
+		subject := strings.SplitN(commit.Message, "\n", 2)[0]
+		b.Prerequisites = append(b.Prerequisites, BundleRef{Name: subject, Hash: commit.Hash.String()})
+	}
+	objects, err := revlist.Objects(c.r.Storer, wants, haves)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeBundleHeader(bw, b); err != nil {
+		return err
+	}
+	if _, err := packfile.NewEncoder(bw, c.r.Storer, false).Encode(objects, 10); err != nil {
+		return errors.Wrap(err, "failed to write packfile")
+	}
+	return bw.Flush()
+}
+
+// ReadBundle reads the header of the bundle at bundlePath.
+func ReadBundle(bundlePath string) (Bundle, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return Bundle{}, err
+	}
+	defer f.Close()
+	return readBundleHeader(bufio.NewReader(f))
+}
+
+// CloneFromBundle clones the bundle at bundlePath into opt.DirPath. origin points to the bundle
+// and opt.Revision is checked out, falling back to the branch of the bundled HEAD.
+func CloneFromBundle(opt ClientOpt, bundlePath string) (Client, error) {
+	r, err := git.PlainInit(opt.DirPath, false)
+	if err != nil {
+		return Client{}, err
+	}
+	c := Client{opt: opt, r: r}
+	if _, err := r.CreateRemote(&config.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{bundlePath},
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, "origin"))},
+	}); err != nil {
+		return Client{}, err
+	}
+	b, err := c.fetchBundle(bundlePath, FetchBundleOpt{})
+	if err != nil {
+		return Client{}, errors.Wrap(err, "failed to clone")
+	}
+	branch := opt.Revision
+	if _, err := r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true); branch == "" || err != nil {
+		if branch = bundleHeadBranch(b); branch == "" {
+			return Client{}, errors.Errorf("branch %s is not found in the bundle", opt.Revision)
+		}
+	}
+	remote, err := r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return Client{}, err
+	}
+	ref := plumbing.NewBranchReferenceName(branch)
+	if err := r.Storer.SetReference(plumbing.NewHashReference(ref, remote.Hash())); err != nil {
+		return Client{}, err
+	}
+	if err := r.CreateBranch(&config.Branch{Name: branch, Remote: "origin", Merge: ref}); err != nil {
+		return Client{}, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return Client{}, err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: ref, Force: true}); err != nil {
+		return Client{}, err
+	}
+	c.opt.Revision = branch
+	return c, nil
+}
+
+// FetchFromBundle fetches the bundle at bundlePath like git fetch does from origin.
+// Branches update refs/remotes/origin and tags update refs/tags.
+func (c *Client) FetchFromBundle(bundlePath string) error {
+	return c.FetchFromBundleWith(bundlePath, FetchBundleOpt{})
+}
+
+// FetchFromBundleWith is FetchFromBundle with options. Like git fetch, tags pointing at
+// other objects are left as they are and reported in the error after the other refs are updated.
+func (c *Client) FetchFromBundleWith(bundlePath string, opt FetchBundleOpt) error {
+	_, err := c.fetchBundle(bundlePath, opt)
+	return err
+}
+
+func (c *Client) fetchBundle(bundlePath string, opt FetchBundleOpt) (Bundle, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return Bundle{}, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	b, err := readBundleHeader(br)
+	if err != nil {
+		return Bundle{}, err
+	}
+	missing := []string{}
+	for _, p := range b.Prerequisites {
+		if _, err := c.r.CommitObject(plumbing.NewHash(p.Hash)); err != nil {
+			missing = append(missing, p.Hash)
+		}
+	}
+	if len(missing) > 0 {
+		return Bundle{}, errors.Errorf("repository lacks these prerequisite commits: %s", strings.Join(missing, ", "))
+	}
+	if err := packfile.UpdateObjectStorage(c.r.Storer, br); err != nil {
+		return Bundle{}, errors.Wrap(err, "failed to read packfile")
+	}
+	rejected := []string{}
+	for _, ref := range b.Refs {
+		name := plumbing.ReferenceName(ref.Name)
+		hash := plumbing.NewHash(ref.Hash)
+		switch {
+		case name.IsBranch():
+			name = plumbing.NewRemoteReferenceName("origin", name.Short())
+		case name.IsTag():
+			old, err := c.r.Storer.Reference(name)
+			if err != nil && err != plumbing.ErrReferenceNotFound {
+				return Bundle{}, err
+			}
+			if err == nil && old.Hash() != hash && !opt.Force {
+				rejected = append(rejected, name.Short())
+				continue
+			}
+		default:
+			continue
+		}
+		if err := c.r.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return Bundle{}, err
+		}
+	}
+	if len(rejected) > 0 {
+		return b, errors.Errorf("rejected tags that would clobber existing tags: %s", strings.Join(rejected, ", "))
+	}
+	return b, nil
+}
+
+// bundleRef resolves name to a full reference. HEAD is kept as is.
+func (c *Client) bundleRef(name string) (*plumbing.Reference, error) {
+	if name == "HEAD" {
+		head, err := c.r.Head()
+		if err != nil {
+			return nil, err
+		}
+		return plumbing.NewHashReference(plumbing.HEAD, head.Hash()), nil
+	}
+	for _, rule := range plumbing.RefRevParseRules {
+		ref, err := c.r.Reference(plumbing.ReferenceName(fmt.Sprintf(rule, name)), true)
+		if err == nil {
+			return ref, nil
+		}
+	}
+	return nil, errors.Errorf("failed to resolve reference %s", name)
+}
+
+// bundleBoundary returns the excluded parents of bundled commits, and whether no commit
+// is bundled at all.
+func (c *Client) bundleBoundary(wants []plumbing.Hash, excluded map[plumbing.Hash]bool) ([]*object.Commit, bool, error) {
+	ret := []*object.Commit{}
+	seen := map[plumbing.Hash]bool{}
+	empty := true
+	for _, h := range wants {
+		commit, err := c.peelCommit(h)
+		if err != nil {
+			return nil, false, err
+		}
+		if excluded[commit.Hash] {
+			continue
+		}
+		empty = false
+		err = object.NewCommitPreorderIter(commit, excluded, nil).ForEach(func(commit *object.Commit) error {
+			for _, p := range commit.ParentHashes {
+				if !excluded[p] || seen[p] {
+					continue
+				}
+				seen[p] = true
+				parent, err := c.r.CommitObject(p)
+				if err != nil {
+					return err
+				}
+				ret = append(ret, parent)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return ret, empty, nil
+}
+
+// peelCommit returns the commit h points to, following annotated tags.
+func (c *Client) peelCommit(h plumbing.Hash) (*object.Commit, error) {
+	if tag, err := c.r.TagObject(h); err == nil {
+		return tag.Commit()
+	}
+	return c.r.CommitObject(h)
+}
+
+func bundleHeadBranch(b Bundle) string {
+	head := ""
+	for _, ref := range b.Refs {
+		if ref.Name == plumbing.HEAD.String() {
+			head = ref.Hash
+		}
+	}
+	for _, ref := range b.Refs {
+		name := plumbing.ReferenceName(ref.Name)
+		if name.IsBranch() && (head == "" || ref.Hash == head) {
+			return name.Short()
+		}
+	}
+	return ""
+}
+
+func writeBundleHeader(w io.Writer, b Bundle) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# v%d git bundle\n", b.Version)
+	if b.Version == 3 {
+		sb.WriteString("@object-format=sha1\n")
+	}
+	for _, p := range b.Prerequisites {
+		fmt.Fprintf(&sb, "-%s %s\n", p.Hash, p.Name)
+	}
+	for _, ref := range b.Refs {
+		fmt.Fprintf(&sb, "%s %s\n", ref.Hash, ref.Name)
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// readBundleHeader reads up to the blank line, leaving r at the packfile.
+func readBundleHeader(r *bufio.Reader) (Bundle, error) {
+	b := Bundle{Prerequisites: []BundleRef{}, Refs: []BundleRef{}}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return b, errors.Wrap(err, "failed to read bundle signature")
+	}
+	switch line {
+	case "# v2 git bundle\n":
+		b.Version = 2
+	case "# v3 git bundle\n":
+		b.Version = 3
+	default:
+		return b, errors.Errorf("unsupported bundle signature %q", strings.TrimSpace(line))
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return b, errors.Wrap(err, "failed to read bundle header")
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return b, nil
+		case strings.HasPrefix(line, "@"):
+			if b.Version != 3 {
+				return b, errors.Errorf("capability %s needs a v3 bundle", line)
+			}
+			if line != "@object-format=sha1" {
+				return b, errors.Errorf("unsupported bundle capability %s", line)
+			}
+		case strings.HasPrefix(line, "-"):
+			fields := strings.SplitN(line[1:], " ", 2)
+			if !plumbing.IsHash(fields[0]) {
+				return b, errors.Errorf("invalid bundle prerequisite line %q", line)
+			}
+			p := BundleRef{Hash: fields[0]}
+			if len(fields) == 2 {
+				p.Name = fields[1]
+			}
+			b.Prerequisites = append(b.Prerequisites, p)
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 || !plumbing.IsHash(fields[0]) {
+				return b, errors.Errorf("invalid bundle ref line %q", line)
+			}
+			b.Refs = append(b.Refs, BundleRef{Hash: fields[0], Name: fields[1]})
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package gtc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func mockForBundle() Client {
+	c := mockInit()
+	c.CommitFiles(map[string][]byte{"second": {1}}, "second")
+	c.CreateTag("v1", "HEAD", CreateTagOpt{Message: "v1"})
+	c.CreateBranch("feature", false)
+	c.CommitFiles(map[string][]byte{"feature": {2}}, "feature")
+	c.Checkout("master", false)
+	c.CommitFiles(map[string][]byte{"third": {3}, "dir/dir_file": {4}}, "third")
+	return c
+}
+
+func createBundle(t *testing.T, c Client, opt BundleOpt) string {
+	p := filepath.Join(c.opt.DirPath, ".git", "test.bundle")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := c.CreateBundleWith(f, opt); err != nil {
+		t.Fatalf("Client.CreateBundleWith() error = %v", err)
+	}
+	return p
+}
+
+func TestClient_CreateBundle(t *testing.T) {
+	c := mockForBundle()
+	tests := []struct {
+		name  string
+		opt   BundleOpt
+		flags []string
+		args  []string
+	}{
+		{name: "full", opt: BundleOpt{Refs: []string{"master", "feature", "v1", "HEAD"}}, args: []string{"master", "feature", "v1", "HEAD"}},
+		{name: "incremental", opt: BundleOpt{Refs: []string{"master", "feature"}, Basis: []string{"v1"}}, args: []string{"master", "feature", "^v1"}},
+		{name: "v3", opt: BundleOpt{Refs: []string{"master"}, Basis: []string{"master~1"}, Version: 3}, flags: []string{"--version=3"}, args: []string{"master", "^master~1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := createBundle(t, c, tt.opt)
+			if out, err := c.gitExec([]string{"bundle", "verify", "-q", p}); err != nil {
+				t.Fatalf("git bundle verify: %v", out)
+			}
+			want := filepath.Join(c.opt.DirPath, ".git", "want.bundle")
+			if out, err := c.gitExec(append(append(append([]string{"bundle", "create", "-q"}, tt.flags...), want), tt.args...)); err != nil {
+				t.Fatalf("git bundle create: %v", out)
+			}
+			got, err := ReadBundle(p)
+			if err != nil {
+				t.Fatalf("ReadBundle() error = %v", err)
+			}
+			wantHeader, err := ReadBundle(want)
+			if err != nil {
+				t.Fatalf("ReadBundle() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, wantHeader) {
+				t.Errorf("bundle header = %v, want %v", got, wantHeader)
+			}
+		})
+	}
+	if err := c.CreateBundle(&os.File{}, []string{"v1"}, []string{"master"}); err == nil {
+		t.Errorf("Client.CreateBundle() should refuse an empty bundle")
+	}
+}
+
+func TestCloneFromBundle(t *testing.T) {
+	src := mockForBundle()
+	full := createBundle(t, src, BundleOpt{Refs: []string{"master", "feature", "v1", "HEAD"}})
+	opt := mockOpt()
+	opt.Revision = ""
+	c, err := CloneFromBundle(opt, full)
+	if err != nil {
+		t.Fatalf("CloneFromBundle() error = %v", err)
+	}
+	if got, want := c.mustHash("HEAD"), src.mustHash("master"); got != want || c.opt.Revision != "master" {
+		t.Errorf("cloned HEAD = %v %v, want %v master", got, c.opt.Revision, want)
+	}
+	if got, want := c.mustHash("origin/feature"), src.mustHash("feature"); got != want {
+		t.Errorf("origin/feature = %v, want %v", got, want)
+	}
+	assertion(t, c, map[string][]string{"status": {""}})
+	if out, err := c.gitExec([]string{"fsck", "--strict"}); err != nil {
+		t.Errorf("git fsck: %v", out)
+	}
+
+	src.CommitFiles(map[string][]byte{"fourth": {5}}, "fourth")
+	incremental := filepath.Join(src.opt.DirPath, ".git", "git.bundle")
+	if out, err := src.gitExec([]string{"bundle", "create", "-q", incremental, "master", "^v1"}); err != nil {
+		t.Fatalf("git bundle create: %v", out)
+	}
+	if err := c.FetchFromBundle(incremental); err != nil {
+		t.Fatalf("Client.FetchFromBundle() error = %v", err)
+	}
+	if got, want := c.mustHash("origin/master"), src.mustHash("master"); got != want {
+		t.Errorf("origin/master = %v, want %v", got, want)
+	}
+	files, err := c.ReadFilesAt("origin/master", ReadFilesOpt{Paths: []string{"fourth"}})
+	if err != nil || !reflect.DeepEqual(files, map[string][]byte{"fourth": {5}}) {
+		t.Errorf("fetched files = %v, %v", files, err)
+	}
+
+	empty, _ := Init(mockOpt())
+	if err := empty.FetchFromBundle(incremental); err == nil {
+		t.Errorf("Client.FetchFromBundle() should fail without prerequisites")
+	}
+}
+
+func TestClient_FetchFromBundleWith_tags(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     FetchBundleOpt
+		wantTag string
+		wantErr bool
+	}{
+		{name: "rejected", opt: FetchBundleOpt{}, wantTag: "old", wantErr: true},
+		{name: "force", opt: FetchBundleOpt{Force: true}, wantTag: "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := mockForBundle()
+			opt := mockOpt()
+			opt.Revision = ""
+			c, err := CloneFromBundle(opt, createBundle(t, src, BundleOpt{Refs: []string{"master", "v1"}}))
+			if err != nil {
+				t.Fatalf("CloneFromBundle() error = %v", err)
+			}
+			old := c.mustHash("v1")
+			src.CommitFiles(map[string][]byte{"fourth": {5}}, "fourth")
+			src.CreateTag("v1", "master", CreateTagOpt{Message: "moved", Force: true})
+			src.CreateTag("v2", "master", CreateTagOpt{})
+			err = c.FetchFromBundleWith(createBundle(t, src, BundleOpt{Refs: []string{"master", "v1", "v2"}}), tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.FetchFromBundleWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := map[string]string{"old": old, "new": src.mustHash("v1")}[tt.wantTag]
+			if got := c.mustHash("v1"); got != want {
+				t.Errorf("v1 = %v, want %v", got, want)
+			}
+			if got, want := c.mustHash("v2"), src.mustHash("v2"); got != want {
+				t.Errorf("v2 = %v, want %v", got, want)
+			}
+			if got, want := c.mustHash("origin/master"), src.mustHash("master"); got != want {
+				t.Errorf("origin/master = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package gtc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+type ChangelogFormat string
+
+const (
+	ChangelogMarkdown ChangelogFormat = "markdown"
+	ChangelogJSON     ChangelogFormat = "json"
+)
+
+type ChangelogOpt struct {
+	Format ChangelogFormat
+	// GroupByScope groups commits by Conventional Commits scope instead of type.
+	GroupByScope bool
+	// CommitURL is a text/template rendered with the entry, e.g.
+	// "https://github.com/takutakahashi/gtc/commit/{{.Hash}}".
+	CommitURL string
+	// Title is the heading of the release. Empty means toRev or "Unreleased".
+	Title string
+}
+
+type ChangelogEntry struct {
+	Hash     string `json:"hash" yaml:"hash"`
+	Short    string `json:"short" yaml:"short"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+	Scope    string `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Subject  string `json:"subject" yaml:"subject"`
+	Breaking bool   `json:"breaking" yaml:"breaking"`
+	Author   string `json:"author" yaml:"author"`
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+type ChangelogGroup struct {
+	Title   string           `json:"title" yaml:"title"`
+	Entries []ChangelogEntry `json:"entries" yaml:"entries"`
+}
+
+type ChangelogData struct {
+	Title   string           `json:"title" yaml:"title"`
+	Groups  []ChangelogGroup `json:"groups" yaml:"groups"`
+	Authors []string         `json:"authors" yaml:"authors"`
+}
+
+var changelogTypeTitles = map[string]string{
+	"feat":     "Features",
+	"fix":      "Bug Fixes",
+	"perf":     "Performance Improvements",
+	"revert":   "Reverts",
+	"refactor": "Code Refactoring",
+	"docs":     "Documentation",
+}
+
+var changelogTypeOrder = []string{"feat", "fix", "perf", "revert", "refactor", "docs", ""}
+
+// Changelog renders the commits in fromTag..toRev. An empty fromTag means the whole history.
+func (c *Client) Changelog(fromTag, toRev string, opt ChangelogOpt) ([]byte, error) {
+	data, err := c.ChangelogData(fromTag, toRev, opt)
+	if err != nil {
+		return nil, err
+	}
+	switch opt.Format {
+	case ChangelogJSON:
+		return json.MarshalIndent(data, "", "  ")
+	case ChangelogMarkdown, "":
+		return data.markdown(), nil
+	}
+	return nil, errors.Errorf("unknown changelog format %s", opt.Format)
+}
+
+func (c *Client) ChangelogData(fromTag, toRev string, opt ChangelogOpt) (ChangelogData, error) {
+	var urlTemplate *template.Template
+	if opt.CommitURL != "" {
+		t, err := template.New("url").Parse(opt.CommitURL)
+		if err != nil {
+			return ChangelogData{}, errors.Wrap(err, "invalid commit url template")
+		}
+		urlTemplate = t
+	}
+	rng := toRev
+	if fromTag != "" {
+		rng = fmt.Sprintf("%s..%s", plumbingTagName(fromTag), toRev)
+	}
+	iter, err := c.Log(LogOpt{Range: rng})
+	if err != nil {
+		return ChangelogData{}, err
+	}
+	ret := ChangelogData{Title: opt.Title, Groups: []ChangelogGroup{}, Authors: []string{}}
+	if ret.Title == "" {
+		ret.Title = toRev
+	}
+	if ret.Title == "" {
+		ret.Title = "Unreleased"
+	}
+	groups, authors := map[string][]ChangelogEntry{}, map[string]bool{}
+	if err := iter.ForEach(func(commit Commit) error {
+		entry := newChangelogEntry(commit)
+		if urlTemplate != nil {
+			buf := bytes.NewBuffer(nil)
+			if err := urlTemplate.Execute(buf, entry); err != nil {
+				return err
+			}
+			entry.URL = buf.String()
+		}
+		key := entry.Type
+		if _, ok := changelogTypeTitles[key]; !ok {
+			key = ""
+		}
+		if opt.GroupByScope {
+			key = entry.Scope
+		}
+		if entry.Breaking && !opt.GroupByScope {
+			groups["!"] = append(groups["!"], entry)
+		}
+		groups[key] = append(groups[key], entry)
+		authors[entry.Author] = true
+		return nil
+	}); err != nil {
+		return ChangelogData{}, err
+	}
+	for a := range authors {
+		ret.Authors = append(ret.Authors, a)
+	}
+	sort.Strings(ret.Authors)
+	if opt.GroupByScope {
+		scopes := []string{}
+		for scope := range groups {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+		for _, scope := range scopes {
+			title := scope
+			if title == "" {
+				title = "General"
+			}
+			ret.Groups = append(ret.Groups, ChangelogGroup{Title: title, Entries: groups[scope]})
+		}
+		return ret, nil
+	}
+	for _, key := range append([]string{"!"}, changelogTypeOrder...) {
+		entries, ok := groups[key]
+		if !ok {
+			continue
+		}
+		title := changelogTypeTitles[key]
+		switch key {
+		case "!":
+			title = "BREAKING CHANGES"
+		case "":
+			title = "Other Changes"
+		}
+		ret.Groups = append(ret.Groups, ChangelogGroup{Title: title, Entries: entries})
+	}
+	return ret, nil
+}
+
+// UpdateChangelogFile prepends content to the changelog at path and commits it.
+// A leading "# " heading of the existing file is kept on top.
+func (c *Client) UpdateChangelogFile(path string, content []byte, message string) error {
+	current, err := ioutil.ReadFile(filepath.Join(c.opt.DirPath, path))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	head := []byte{}
+	if bytes.HasPrefix(current, []byte("# ")) {
+		i := bytes.IndexByte(current, '\n')
+		if i < 0 {
+			i = len(current) - 1
+		}
+		head, current = append(current[:i+1:i+1], '\n'), bytes.TrimLeft(current[i+1:], "\n")
+	}
+	blob := append(append(head, bytes.TrimRight(content, "\n")...), '\n')
+	if len(current) > 0 {
+		blob = append(append(blob, '\n'), current...)
+	}
+	return c.CommitFiles(map[string][]byte{path: blob}, message)
+}
+
+func plumbingTagName(tag string) string {
+	if strings.HasPrefix(tag, "refs/") {
+		return tag
+	}
+	return "refs/tags/" + tag
+}
+
+func newChangelogEntry(commit Commit) ChangelogEntry {
+	subject := strings.Split(commit.Message, "\n")[0]
+	entry := ChangelogEntry{
+		Hash:     commit.Hash,
+		Short:    commit.Hash[:7],
+		Subject:  subject,
+		Author:   commit.Author.Name,
+		Breaking: conventionalBump(commit) == BumpMajor,
+	}
+	if m := conventionalHeader.FindStringSubmatch(subject); m != nil {
+		entry.Type = strings.ToLower(m[1])
+		entry.Scope = strings.Trim(m[2], "()")
+		entry.Subject = strings.TrimPrefix(subject, m[0])
+	}
+	return entry
+}
+
+func (d ChangelogData) markdown() []byte {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "## %s\n", d.Title)
+	for _, g := range d.Groups {
+		fmt.Fprintf(buf, "\n### %s\n\n", g.Title)
+		for _, e := range g.Entries {
+			buf.WriteString("- ")
+			if e.Scope != "" {
+				fmt.Fprintf(buf, "**%s:** ", e.Scope)
+			}
+			buf.WriteString(e.Subject)
+			if e.URL != "" {
+				fmt.Fprintf(buf, " ([%s](%s))\n", e.Short, e.URL)
+			} else {
+				fmt.Fprintf(buf, " (%s)\n", e.Short)
+			}
+		}
+	}
+	if len(d.Authors) > 0 {
+		buf.WriteString("\n### Authors\n\n")
+		for _, a := range d.Authors {
+			fmt.Fprintf(buf, "- %s\n", a)
+		}
+	}
+	return buf.Bytes()
+}
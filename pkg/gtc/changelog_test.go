@@ -0,0 +1,137 @@
+package gtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func mockWithConventionalCommits() Client {
+	c := mockWithTags([]string{"v1.0.0"})
+	for i, message := range []string{"feat(api): add endpoint", "fix: crash on start", "chore: bump deps", "feat!: drop v1"} {
+		c.opt.AuthorName = []string{"alice", "bob", "bob", "carol"}[i]
+		c.CommitFiles(map[string][]byte{mkTestName(): {byte(i)}}, message)
+	}
+	c.opt.AuthorName = "bob"
+	return c
+}
+
+func TestClient_ChangelogData(t *testing.T) {
+	c := mockWithConventionalCommits()
+	titles := func(d ChangelogData) map[string][]string {
+		ret := map[string][]string{}
+		for _, g := range d.Groups {
+			for _, e := range g.Entries {
+				ret[g.Title] = append(ret[g.Title], e.Subject)
+			}
+		}
+		return ret
+	}
+	tests := []struct {
+		name    string
+		from    string
+		opt     ChangelogOpt
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name: "by_type",
+			from: "v1.0.0",
+			want: map[string][]string{
+				"BREAKING CHANGES": {"drop v1"},
+				"Features":         {"drop v1", "add endpoint"},
+				"Bug Fixes":        {"crash on start"},
+				"Other Changes":    {"bump deps"},
+			},
+		},
+		{
+			name: "by_scope",
+			from: "v1.0.0",
+			opt:  ChangelogOpt{GroupByScope: true},
+			want: map[string][]string{
+				"General": {"drop v1", "bump deps", "crash on start"},
+				"api":     {"add endpoint"},
+			},
+		},
+		{
+			name:    "ng_tag",
+			from:    "v9.9.9",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ChangelogData(tt.from, "HEAD", tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.ChangelogData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, titles(got)); diff != "" {
+				t.Errorf("Client.ChangelogData() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]string{"alice", "bob", "carol"}, got.Authors); diff != "" {
+				t.Errorf("Client.ChangelogData() authors mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_Changelog(t *testing.T) {
+	c := mockWithConventionalCommits()
+	data, _ := c.ChangelogData("v1.0.0", "HEAD", ChangelogOpt{})
+	short := map[string]string{}
+	for _, g := range data.Groups {
+		for _, e := range g.Entries {
+			short[e.Subject] = e.Short
+		}
+	}
+	got, err := c.Changelog("v1.0.0", "HEAD", ChangelogOpt{Title: "v2.0.0", CommitURL: "https://example.com/commit/{{.Short}}"})
+	if err != nil {
+		t.Errorf("Client.Changelog() error = %v", err)
+	}
+	link := func(subject string) string {
+		return fmt.Sprintf("([%s](https://example.com/commit/%s))", short[subject], short[subject])
+	}
+	want := "## v2.0.0\n\n" +
+		"### BREAKING CHANGES\n\n- drop v1 " + link("drop v1") + "\n\n" +
+		"### Features\n\n- drop v1 " + link("drop v1") + "\n- **api:** add endpoint " + link("add endpoint") + "\n\n" +
+		"### Bug Fixes\n\n- crash on start " + link("crash on start") + "\n\n" +
+		"### Other Changes\n\n- bump deps " + link("bump deps") + "\n\n" +
+		"### Authors\n\n- alice\n- bob\n- carol\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Client.Changelog() mismatch (-want +got):\n%s", diff)
+	}
+	b, err := c.Changelog("v1.0.0", "HEAD", ChangelogOpt{Format: ChangelogJSON})
+	if err != nil || !json.Valid(b) {
+		t.Errorf("Client.Changelog() json = %s, %v", b, err)
+	}
+	if _, err := c.Changelog("v1.0.0", "HEAD", ChangelogOpt{Format: "html"}); err == nil {
+		t.Errorf("Client.Changelog() should fail for unknown formats")
+	}
+}
+
+func TestClient_UpdateChangelogFile(t *testing.T) {
+	c := mockInit()
+	if err := c.UpdateChangelogFile("CHANGELOG.md", []byte("## v0.1.0\n\n- first\n"), "changelog v0.1.0"); err != nil {
+		t.Errorf("Client.UpdateChangelogFile() error = %v", err)
+	}
+	c.CommitFiles(map[string][]byte{"CHANGELOG.md": []byte("# Changelog\n\n## v0.1.0\n\n- first\n")}, "add heading")
+	if err := c.UpdateChangelogFile("CHANGELOG.md", []byte("## v0.2.0\n\n- second\n"), "changelog v0.2.0"); err != nil {
+		t.Errorf("Client.UpdateChangelogFile() error = %v", err)
+	}
+	got, _ := ioutil.ReadFile(c.opt.DirPath + "/CHANGELOG.md")
+	want := "# Changelog\n\n## v0.2.0\n\n- second\n\n## v0.1.0\n\n- first\n"
+	if string(got) != want {
+		t.Errorf("CHANGELOG.md = %q, want %q", got, want)
+	}
+	assertion(t, c, map[string][]string{
+		"latestCommitMessage": {"changelog v0.2.0", ""},
+		"status":              {""},
+	})
+}
@@ -0,0 +1,223 @@
+package gtc
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type Divergence struct {
+	// Upstream is the compared ref. It is set only in Info.
+	Upstream  string `json:"upstream" yaml:"upstream"`
+	MergeBase string `json:"mergeBase" yaml:"mergeBase"`
+	Ahead     int    `json:"ahead" yaml:"ahead"`
+	Behind    int    `json:"behind" yaml:"behind"`
+	// Unknown is set when a shallow history ends before the merge base. Ahead and Behind are 0.
+	Unknown bool `json:"unknown" yaml:"unknown"`
+}
+
+type Comparison struct {
+	Divergence
+	// AheadCommits are reachable from a but not from b, newest first.
+	AheadCommits []Commit
+	// BehindCommits are reachable from b but not from a, newest first.
+	BehindCommits []Commit
+}
+
+// State returns one of "up-to-date", "ahead", "behind", "diverged" or "unknown".
+func (d Divergence) State() string {
+	switch {
+	case d.Unknown:
+		return "unknown"
+	case d.Ahead == 0 && d.Behind == 0:
+		return "up-to-date"
+	case d.Behind == 0:
+		return "ahead"
+	case d.Ahead == 0:
+		return "behind"
+	}
+	return "diverged"
+}
+
+// Compare reports how revision a relates to revision b, e.g. Compare("master", "origin/master").
+func (c *Client) Compare(a, b string) (Comparison, error) {
+	ac, err := c.resolveCommit(a)
+	if err != nil {
+		return Comparison{}, err
+	}
+	bc, err := c.resolveCommit(b)
+	if err != nil {
+		return Comparison{}, err
+	}
+	d, sides, err := c.walkSides(ac, bc)
+	if err != nil {
+		return Comparison{}, err
+	}
+	ret := Comparison{Divergence: d, AheadCommits: []Commit{}, BehindCommits: []Commit{}}
+	if d.Unknown {
+		return ret, nil
+	}
+	if ret.AheadCommits, err = sideCommits(ac, sides, aheadSide); err != nil {
+		return Comparison{}, err
+	}
+	if ret.BehindCommits, err = sideCommits(bc, sides, behindSide); err != nil {
+		return Comparison{}, err
+	}
+	return ret, nil
+}
+
+const (
+	aheadSide = 1 << iota
+	behindSide
+	bothSides = aheadSide | behindSide
+)
+
+// aheadBehind counts the commits reachable only from a and only from b without listing them.
+func (c *Client) aheadBehind(a, b *object.Commit) (Divergence, error) {
+	d, _, err := c.walkSides(a, b)
+	return d, err
+}
+
+// walkSides marks the commits reachable from a, b or both. Like git, it walks both sides
+// newest first and stops once every queued commit is reachable from both, so only the
+// commits down to the merge base are read. When the merge base may lie beyond shallow
+// history, the divergence is unknown and the flags treat shallow commits as roots.
+func (c *Client) walkSides(a, b *object.Commit) (Divergence, map[plumbing.Hash]int, error) {
+	shallows, err := c.r.Storer.Shallow()
+	if err != nil {
+		return Divergence{}, nil, err
+	}
+	shallow := map[plumbing.Hash]bool{}
+	for _, h := range shallows {
+		shallow[h] = true
+	}
+	ret := Divergence{}
+	flags := map[plumbing.Hash]int{a.Hash: aheadSide}
+	flags[b.Hash] |= behindSide
+	queue := []*object.Commit{a, b}
+	// boundaries are shallow commits whose missing parents may hold the merge base
+	boundaries := []plumbing.Hash{}
+	for {
+		next, done := -1, true
+		for i, commit := range queue {
+			if flags[commit.Hash] != bothSides {
+				done = false
+			}
+			if next < 0 || commit.Committer.When.After(queue[next].Committer.When) {
+				next = i
+			}
+		}
+		if done {
+			break
+		}
+		commit := queue[next]
+		queue = append(queue[:next], queue[next+1:]...)
+		f := flags[commit.Hash]
+		if f == bothSides && ret.MergeBase == "" {
+			ret.MergeBase = commit.Hash.String()
+		}
+		if shallow[commit.Hash] {
+			boundaries = append(boundaries, commit.Hash)
+			continue
+		}
+		for _, h := range commit.ParentHashes {
+			if flags[h]|f == flags[h] {
+				continue
+			}
+			parent, err := c.r.CommitObject(h)
+			if err != nil {
+				return Divergence{}, nil, err
+			}
+			flags[h] |= f
+			queue = append(queue, parent)
+		}
+	}
+	if ret.MergeBase == "" && len(queue) > 0 {
+		ret.MergeBase = queue[0].Hash.String()
+		for _, commit := range queue[1:] {
+			if commit.Committer.When.After(queue[0].Committer.When) {
+				ret.MergeBase = commit.Hash.String()
+			}
+		}
+	}
+	for _, h := range boundaries {
+		if flags[h] != bothSides {
+			return Divergence{Unknown: true}, flags, nil
+		}
+	}
+	for _, f := range flags {
+		switch f {
+		case aheadSide:
+			ret.Ahead++
+		case behindSide:
+			ret.Behind++
+		}
+	}
+	return ret, flags, nil
+}
+
+// sideCommits lists the commits marked only with side by walkSides, newest first.
+func sideCommits(from *object.Commit, sides map[plumbing.Hash]int, side int) ([]Commit, error) {
+	ret := []Commit{}
+	if sides[from.Hash] != side {
+		return ret, nil
+	}
+	exclude := map[plumbing.Hash]bool{}
+	for h, f := range sides {
+		if f != side {
+			exclude[h] = true
+		}
+	}
+	err := object.NewCommitIterCTime(from, exclude, nil).ForEach(func(commit *object.Commit) error {
+		ret = append(ret, newCommit(commit))
+		return nil
+	})
+	return ret, err
+}
+
+func (c *Client) logList(rng string) ([]Commit, error) {
+	iter, err := c.Log(LogOpt{Range: rng})
+	if err != nil {
+		return nil, err
+	}
+	ret := []Commit{}
+	err = iter.ForEach(func(commit Commit) error {
+		ret = append(ret, commit)
+		return nil
+	})
+	return ret, err
+}
+
+// divergences compares every local branch with its upstream.
+func (c *Client) divergences(branches map[string]string) (map[string]Divergence, error) {
+	ret := map[string]Divergence{}
+	for branch := range branches {
+		upstream, err := c.upstream(branch)
+		if err != nil {
+			continue
+		}
+		d, err := c.divergence(plumbing.NewBranchReferenceName(branch), upstream)
+		if err != nil {
+			return nil, err
+		}
+		d.Upstream = upstream.Short()
+		ret[branch] = d
+	}
+	return ret, nil
+}
+
+// divergence compares the commits of two references.
+func (c *Client) divergence(a, b plumbing.ReferenceName) (Divergence, error) {
+	commits := []*object.Commit{}
+	for _, name := range []plumbing.ReferenceName{a, b} {
+		ref, err := c.r.Reference(name, true)
+		if err != nil {
+			return Divergence{}, err
+		}
+		commit, err := c.r.CommitObject(ref.Hash())
+		if err != nil {
+			return Divergence{}, err
+		}
+		commits = append(commits, commit)
+	}
+	return c.aheadBehind(commits[0], commits[1])
+}
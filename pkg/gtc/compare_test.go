@@ -0,0 +1,127 @@
+package gtc
+
+import (
+	"testing"
+)
+
+func TestClient_Compare(t *testing.T) {
+	c := mockWithHistory()
+	base, _ := c.GetHash("master", false)
+	c.CreateBranch("topic", false)
+	c.CommitFiles(map[string][]byte{"topic.txt": []byte("topic")}, "topic")
+	c.Checkout("master", false)
+	c.CommitFiles(map[string][]byte{"master.txt": []byte("master")}, "master")
+	type args struct {
+		a string
+		b string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantAhead  []string
+		wantBehind []string
+		wantState  string
+		wantErr    bool
+	}{
+		{
+			name:       "diverged",
+			args:       args{a: "topic", b: "master"},
+			wantAhead:  []string{"topic"},
+			wantBehind: []string{"master"},
+			wantState:  "diverged",
+		},
+		{
+			name:       "behind",
+			args:       args{a: "HEAD~2", b: "master"},
+			wantAhead:  []string{},
+			wantBehind: []string{"master", "update renamed"},
+			wantState:  "behind",
+		},
+		{
+			name:       "ahead",
+			args:       args{a: "master", b: "HEAD~1"},
+			wantAhead:  []string{"master"},
+			wantBehind: []string{},
+			wantState:  "ahead",
+		},
+		{
+			name:       "up-to-date",
+			args:       args{a: "master", b: "master"},
+			wantAhead:  []string{},
+			wantBehind: []string{},
+			wantState:  "up-to-date",
+		},
+		{
+			name:    "ng",
+			args:    args{a: "master", b: "no-rev"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Compare(tt.args.a, tt.args.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Compare() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.State() != tt.wantState {
+				t.Errorf("Client.Compare().State() = %v, want %v", got.State(), tt.wantState)
+			}
+			if got.Ahead != len(tt.wantAhead) || got.Behind != len(tt.wantBehind) {
+				t.Errorf("Client.Compare() = %d/%d, want %d/%d", got.Ahead, got.Behind, len(tt.wantAhead), len(tt.wantBehind))
+			}
+			for i, commit := range got.AheadCommits {
+				if commit.Message != tt.wantAhead[i] {
+					t.Errorf("ahead commit = %v, want %v", commit.Message, tt.wantAhead[i])
+				}
+			}
+			for i, commit := range got.BehindCommits {
+				if commit.Message != tt.wantBehind[i] {
+					t.Errorf("behind commit = %v, want %v", commit.Message, tt.wantBehind[i])
+				}
+			}
+			if tt.name == "diverged" && got.MergeBase != base {
+				t.Errorf("Client.Compare().MergeBase = %v, want %v", got.MergeBase, base)
+			}
+		})
+	}
+}
+
+func TestClient_Compare_shallow(t *testing.T) {
+	src := mockWithHistory()
+	src.CreateBranch("topic", false)
+	src.CommitFiles(map[string][]byte{"topic.txt": []byte("topic")}, "topic")
+	src.Checkout("master", false)
+	opt := mockOpt()
+	if out, err := src.gitExec([]string{"clone", "-q", "--depth=1", "--no-single-branch", "file://" + src.opt.DirPath, opt.DirPath}); err != nil {
+		t.Fatalf("git clone: %v", out)
+	}
+	c, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "commit", "-q", "--allow-empty", "-m", "local"})
+	tests := []struct {
+		name string
+		a, b string
+		want Divergence
+	}{
+		{name: "ahead", a: "master", b: "origin/master", want: Divergence{MergeBase: src.mustHash("master"), Ahead: 1}},
+		{name: "up-to-date", a: "origin/master", b: "origin/master", want: Divergence{MergeBase: src.mustHash("master")}},
+		{name: "unknown", a: "origin/topic", b: "origin/master", want: Divergence{Unknown: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Compare(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Client.Compare() error = %v", err)
+			}
+			if got.Divergence != tt.want {
+				t.Errorf("Client.Compare() = %+v, want %+v", got.Divergence, tt.want)
+			}
+		})
+	}
+}
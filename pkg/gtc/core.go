@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
@@ -29,6 +31,9 @@ type ClientOpt struct {
 	AuthorName   string
 	AuthorEmail  string
 	Auth         AuthMethod
+	// SubmoduleBranches overrides the branch tracked by remote submodule updates,
+	// keyed by submodule name or path.
+	SubmoduleBranches map[string]string
 }
 
 type Client struct {
@@ -43,13 +48,28 @@ type AuthMethod struct {
 	sshPrivateKey []byte
 }
 
+// Info is a snapshot of the repository state. Head is empty when Detached is true,
+// Upstreams maps local branches to their remote tracking branches, TagHashes maps
+// tags to the commits they point at and Remote describes origin as of the last fetch.
 type Info struct {
-	DirPath      string
-	Current      string
-	BranchHashes map[string]string
-	Status       []string
-	Submodules   map[string]Info
-	Remote       *Info
+	DirPath      string                `json:"dirPath" yaml:"dirPath"`
+	Current      string                `json:"current" yaml:"current"`
+	Head         string                `json:"head" yaml:"head"`
+	Detached     bool                  `json:"detached" yaml:"detached"`
+	Shallow      bool                  `json:"shallow" yaml:"shallow"`
+	BranchHashes map[string]string     `json:"branchHashes" yaml:"branchHashes"`
+	Upstreams    map[string]string     `json:"upstreams" yaml:"upstreams"`
+	TagHashes    map[string]string     `json:"tagHashes" yaml:"tagHashes"`
+	Remotes      map[string]RemoteInfo `json:"remotes" yaml:"remotes"`
+	Status       Status                `json:"status" yaml:"status"`
+	Divergence   map[string]Divergence `json:"divergence" yaml:"divergence"`
+	Submodules   map[string]Info       `json:"submodules" yaml:"submodules"`
+	Remote       *Info                 `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+type RemoteInfo struct {
+	URLs         []string          `json:"urls" yaml:"urls"`
+	BranchHashes map[string]string `json:"branchHashes" yaml:"branchHashes"`
 }
 
 func GetAuth(username, password, sshKeyPath string) (AuthMethod, error) {
@@ -256,17 +276,12 @@ func (c *Client) ReplaceToAuthURL(url *urlutil.URL, auth *AuthMethod) error {
 	}
 	newURL := fmt.Sprintf("%s://%s:%s@%s/", url.Scheme, auth.username, auth.password, url.Host)
 	insteadOf := fmt.Sprintf("%s://%s/", url.Scheme, url.Host)
-	out, err := c.gitExec([]string{"config", fmt.Sprintf("url.%s.insteadOf", newURL), insteadOf})
+	cfg, err := c.r.Config()
 	if err != nil {
-		logrus.Error(err)
-		logrus.Error(out)
 		return err
 	}
-	if os.Getenv("GTC_DEBUG") == "true" {
-		out, _ := c.gitExec([]string{"config", "--list"})
-		logrus.Info(out)
-	}
-	return nil
+	cfg.URLs[newURL] = &config.URL{Name: newURL, InsteadOf: insteadOf}
+	return c.r.Storer.SetConfig(cfg)
 }
 func (c *Client) SubmoduleUpdateAuth(path, url string, auth *AuthMethod) error {
 	l, err := urlutil.Parse(url)
@@ -277,23 +292,19 @@ func (c *Client) SubmoduleUpdateAuth(path, url string, auth *AuthMethod) error {
 		if err := c.ReplaceToAuthURL(l, auth); err != nil {
 			return err
 		}
-		newURL := fmt.Sprintf("%s://%s%s", l.Scheme, l.Host, l.Path)
-		if l.Scheme == "" || l.Host == "" {
-			newURL = url
-		}
-		out, err := c.gitExec([]string{"submodule", "set-url", path, newURL})
-		if err != nil {
-			logrus.Error(err)
-			logrus.Error(out)
-			return err
-		}
-		if os.Getenv("GTC_DEBUG") == "true" {
-			out, _ := c.exec("cat", []string{".gitmodules"})
-			logrus.Info(out)
-		}
+		return c.SubmoduleSetURL(path, submoduleURL(l, url))
 	}
 	return nil
 }
+
+// submoduleURL strips credentials from url.
+func submoduleURL(l *urlutil.URL, url string) string {
+	if l.Scheme == "" || l.Host == "" {
+		return url
+	}
+	return fmt.Sprintf("%s://%s%s", l.Scheme, l.Host, l.Path)
+}
+
 func mkAuthMethodInjectedURL(url string, auth *AuthMethod) (string, error) {
 	if auth == nil || auth.username == "" || auth.password == "" {
 		return url, nil
@@ -309,6 +320,9 @@ func mkAuthMethodInjectedURL(url string, auth *AuthMethod) (string, error) {
 }
 
 func (c *Client) SubmoduleAdd(name, url, revision string, auth *AuthMethod) error {
+	if !isRelativePath(name) {
+		return errors.Errorf("invalid submodule path %q", name)
+	}
 	w, err := c.r.Worktree()
 	if err != nil {
 		return err
@@ -320,152 +334,117 @@ func (c *Client) SubmoduleAdd(name, url, revision string, auth *AuthMethod) erro
 	if err != nil {
 		return err
 	}
-	submoduleCmd := []string{"submodule", "add", "-b", revision, repositoryURL, name}
-	// this option is debug or CI only. please refer:
-	// https://bugs.launchpad.net/ubuntu/+source/git/+bug/1993586
-	// FIXME: use go-git only
-	if os.Getenv("GTC_SUBMODULE_PROTOCOL_FILE_ALLOW") == "true" {
-		submoduleCmd = append([]string{"-c", "protocol.file.allow=always"}, submoduleCmd...)
+	var authMethod transport.AuthMethod
+	if auth != nil {
+		authMethod = auth.AuthMethod
 	}
-	if out, err := c.gitExec(submoduleCmd); err != nil {
-		return errors.Wrapf(err, "stderr: %s", out)
+	if err := c.addSubmodule(name, url, repositoryURL, revision, authMethod); err != nil {
+		return err
 	}
 	if err := c.SubmoduleUpdateAuth(name, url, auth); err != nil {
 		return err
 	}
 	return nil
 }
-func (c *Client) submoduleUseRemote() error {
-	w, err := c.r.Worktree()
+
+// submoduleBranch returns the branch to track. ClientOpt.SubmoduleBranches wins over
+// the branch in .gitmodules, and the revision of the client is the fallback.
+func (c *Client) submoduleBranch(modules *format.Config, name, path string) string {
+	for _, key := range []string{name, path} {
+		if branch, ok := c.opt.SubmoduleBranches[key]; ok {
+			return branch
+		}
+	}
+	if branch := modules.Section("submodule").Subsection(name).Option("branch"); branch != "" {
+		return branch
+	}
+	return c.opt.Revision
+}
+
+func (c *Client) submoduleCheckoutRemote(sub *git.Submodule, branch string) error {
+	sr, attachingHash, err := c.submoduleFetchRemote(sub, branch)
 	if err != nil {
 		return err
 	}
-	submodules, err := w.Submodules()
+	sw, err := sr.Worktree()
 	if err != nil {
 		return err
 	}
-	for _, sub := range submodules {
-		if err := c.SubmoduleUpdateAuth(sub.Config().Name, sub.Config().URL, &c.opt.Auth); err != nil {
-			logrus.Error(err)
-		}
-		sr, err := sub.Repository()
-		if err != nil {
-			return err
-		}
-		if err := sr.Fetch(&git.FetchOptions{
-			Auth:  c.opt.Auth.AuthMethod,
-			Force: true,
-		}); err != git.NoErrAlreadyUpToDate {
-			if err == storage.ErrReferenceHasChanged {
-				return c.submoduleUseRemote()
-			}
-			return errors.Wrap(err, "failed to pull submodule")
-		}
-		attachingRemoteBranch := plumbing.NewRemoteReferenceName("origin", c.opt.Revision)
-
-		sw, err := sr.Worktree()
-		if err != nil {
+	if err := sw.Checkout(&git.CheckoutOptions{
+		Force: true,
+		Hash:  attachingHash,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		if err == storage.ErrReferenceHasChanged {
 			return err
 		}
-		attachingHash, err := sr.ResolveRevision(plumbing.Revision(attachingRemoteBranch))
-		if err != nil {
-			return errors.Wrap(err, "failed to resolve revision of remote branch")
-		}
-		if err := sw.Checkout(&git.CheckoutOptions{
-			Force: true,
-			Hash:  *attachingHash,
-		}); err != nil && err != git.NoErrAlreadyUpToDate {
-			if err == storage.ErrReferenceHasChanged {
-				return c.submoduleUseRemote()
-			}
-			return errors.Wrap(err, "failed to checkout submodule")
-		}
+		return errors.Wrap(err, "failed to checkout submodule")
 	}
 	return nil
-
 }
 
-func (c *Client) SubmoduleUpdate(remote bool) error {
-	if remote {
-		return c.submoduleUseRemote()
+// submoduleFetchRemote fetches the submodule and resolves origin/<branch>.
+func (c *Client) submoduleFetchRemote(sub *git.Submodule, branch string) (*git.Repository, plumbing.Hash, error) {
+	sr, err := sub.Repository()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
 	}
-	w, err := c.r.Worktree()
+	if err := sr.Fetch(&git.FetchOptions{
+		Auth:  c.opt.Auth.AuthMethod,
+		Force: true,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		if err == storage.ErrReferenceHasChanged {
+			return nil, plumbing.ZeroHash, err
+		}
+		return nil, plumbing.ZeroHash, errors.Wrap(err, "failed to pull submodule")
+	}
+	attachingRef, err := sr.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
 	if err != nil {
-		return err
+		return nil, plumbing.ZeroHash, err
 	}
-	submodules, err := w.Submodules()
+	return sr, attachingRef.Hash(), nil
+}
+
+func (c *Client) SubmoduleUpdate(remote bool) error {
+	report, err := c.SubmoduleUpdateWith(SubmoduleUpdateOpt{Remote: remote})
 	if err != nil {
 		return err
 	}
-	for _, sub := range submodules {
-		if err := c.SubmoduleUpdateAuth(sub.Config().Name, sub.Config().URL, &c.opt.Auth); err != nil {
-			logrus.Error(err)
-		}
-		if err := sub.Update(&git.SubmoduleUpdateOptions{
-			Init: true,
-			Auth: c.opt.Auth.AuthMethod,
-		}); err != nil && err != git.ErrSubmoduleAlreadyInitialized {
-			if err == storage.ErrReferenceHasChanged {
-				return c.SubmoduleUpdate(remote)
-			}
-			return err
-		}
-		if err := sub.Update(&git.SubmoduleUpdateOptions{
-			Init: false,
-			Auth: c.opt.Auth.AuthMethod,
-		}); err != nil {
-			if err == storage.ErrReferenceHasChanged {
-				return c.SubmoduleUpdate(remote)
-			}
-			return err
-		}
-		sr, err := sub.Repository()
-		if err != nil {
-			return err
-		}
-		sw, err := sr.Worktree()
-		if err != nil {
-			return err
-		}
-		if err := sw.Pull(&git.PullOptions{
-			Auth:  c.opt.Auth.AuthMethod,
-			Force: true,
-		}); err != nil && err != git.NoErrAlreadyUpToDate {
-			if err == storage.ErrReferenceHasChanged {
-				return c.SubmoduleUpdate(remote)
-			}
-			return errors.Wrap(err, "failed to pull submodule")
-		}
-	}
-	return nil
+	return report.Err()
 }
 
-func (c *Client) SubmoduleSyncUpToDate(message string) error {
-	if err := c.SubmoduleUpdate(true); err != nil {
+// submoduleUpdateLocal checks out the recorded commit and pulls the current branch of the submodule.
+func (c *Client) submoduleUpdateLocal(sub *git.Submodule) error {
+	if err := sub.Update(&git.SubmoduleUpdateOptions{
+		Init: false,
+		Auth: c.opt.Auth.AuthMethod,
+	}); err != nil {
 		return err
 	}
-	w, err := c.r.Worktree()
+	sr, err := sub.Repository()
 	if err != nil {
 		return err
 	}
-	status, err := w.Status()
+	sw, err := sr.Worktree()
 	if err != nil {
 		return err
 	}
-	if !status.IsClean() {
-		if out, err := c.gitExec([]string{"add", "-A"}); err != nil {
-			return errors.Wrapf(err, "failed to add stage. %s", out)
-		}
-		if err := c.Commit(message); err != nil {
-			return err
-		}
-		if err := c.Push(); err != nil {
+	if err := sw.Pull(&git.PullOptions{
+		Auth:  c.opt.Auth.AuthMethod,
+		Force: true,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		if err == storage.ErrReferenceHasChanged {
 			return err
 		}
+		return errors.Wrap(err, "failed to pull submodule")
 	}
 	return nil
 }
 
+func (c *Client) SubmoduleSyncUpToDate(message string) error {
+	_, err := c.SubmoduleSyncUpToDateWith(SubmoduleSyncOpt{Message: message})
+	return err
+}
+
 func (c *Client) gitExec(commands []string) ([]string, error) {
 	return c.exec("git", commands)
 }
@@ -504,15 +483,7 @@ func (c *Client) CreateBranch(dst string, recreate bool) error {
 }
 
 func (c *Client) IsClean() (bool, error) {
-	w, err := c.r.Worktree()
-	if err != nil {
-		return false, err
-	}
-	status, err := w.Status()
-	if err != nil {
-		return false, err
-	}
-	return status.IsClean(), nil
+	return c.IsCleanWith(CleanOpt{})
 }
 
 func (c *Client) GetRevisionReferenceName(name string) (plumbing.ReferenceName, error) {
@@ -555,7 +526,8 @@ func info(r *git.Repository) (Info, error) {
 		branchHashes[r.Name().Short()] = r.Hash().String()
 		return nil
 	})
-	status, err := w.Status()
+	sc := Client{opt: ClientOpt{DirPath: ret.DirPath}, r: r}
+	status, err := sc.Status(StatusOpt{})
 	if err != nil {
 		return blank, err
 	}
@@ -575,6 +547,97 @@ func info(r *git.Repository) (Info, error) {
 		ret.Submodules[s.Config().Path] = si
 	}
 	ret.BranchHashes = branchHashes
-	ret.Status = strings.Split(status.String(), "\n")
+	if ret.Divergence, err = sc.divergences(branchHashes); err != nil {
+		return blank, err
+	}
+	ret.Status = status
+	if err := sc.refsInfo(&ret); err != nil {
+		return blank, err
+	}
 	return ret, nil
 }
+
+func (c *Client) refsInfo(ret *Info) error {
+	head, err := c.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		ret.Head = head.Target().String()
+	} else {
+		ret.Detached = true
+	}
+	shallows, err := c.r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+	ret.Shallow = len(shallows) > 0
+	ret.Upstreams = map[string]string{}
+	for branch := range ret.BranchHashes {
+		if upstream, err := c.upstream(branch); err == nil {
+			ret.Upstreams[branch] = upstream.Short()
+		}
+	}
+	ret.TagHashes = map[string]string{}
+	tags, err := c.r.Tags()
+	if err != nil {
+		return err
+	}
+	if err := tags.ForEach(func(ref *plumbing.Reference) error {
+		h, err := c.r.ResolveRevision(plumbing.Revision(ref.Name()))
+		if err != nil {
+			return err
+		}
+		ret.TagHashes[ref.Name().Short()] = h.String()
+		return nil
+	}); err != nil {
+		return err
+	}
+	ret.Remotes = map[string]RemoteInfo{}
+	remotes, err := c.r.Remotes()
+	if err != nil {
+		return err
+	}
+	for _, remote := range remotes {
+		ret.Remotes[remote.Config().Name] = RemoteInfo{
+			URLs:         remote.Config().URLs,
+			BranchHashes: map[string]string{},
+		}
+	}
+	refs, err := c.r.References()
+	if err != nil {
+		return err
+	}
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsRemote() || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		name := strings.TrimPrefix(ref.Name().String(), "refs/remotes/")
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return nil
+		}
+		if remote, ok := ret.Remotes[name[:i]]; ok {
+			remote.BranchHashes[name[i+1:]] = ref.Hash().String()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Remote is the remote of the upstream of HEAD, falling back to origin
+	name, branch := "origin", ""
+	if !ret.Detached {
+		if remote, merge, err := c.upstreamBranch(strings.TrimPrefix(ret.Head, "refs/heads/")); err == nil {
+			if _, ok := ret.Remotes[remote]; ok {
+				name, branch = remote, merge
+			}
+		}
+	}
+	if remote, ok := ret.Remotes[name]; ok {
+		ret.Remote = &Info{BranchHashes: remote.BranchHashes}
+		if branch != "" {
+			ret.Remote.Current = remote.BranchHashes[branch]
+		}
+	}
+	return nil
+}
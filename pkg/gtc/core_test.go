@@ -1,6 +1,7 @@
 package gtc
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
@@ -739,7 +740,7 @@ func TestClient_SubmoduleSyncUpToDate(t *testing.T) {
 				message: "submodule update",
 			},
 			asserts: map[string][]string{
-				"latestCommitMessage": {"submodule update", ""},
+				"latestCommitMessage": {"submodule update", "", "* test: add %s", "", ""},
 				"status":              {""},
 			},
 			wantErr: false,
@@ -762,6 +763,10 @@ func TestClient_SubmoduleSyncUpToDate(t *testing.T) {
 			if err := c.SubmoduleSyncUpToDate(tt.args.message); (err != nil) != tt.wantErr {
 				t.Errorf("Client.SubmoduleSyncUpToDate() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			// the added gitlink is abbreviated in the generated message
+			if msg, ok := tt.asserts["latestCommitMessage"]; ok && len(msg) > 2 {
+				msg[2] = fmt.Sprintf(msg[2], gitRevParse(t, c, "HEAD:test")[:7])
+			}
 			assertion(t, c, tt.asserts)
 		})
 	}
@@ -902,6 +907,8 @@ func TestClient_Info(t *testing.T) {
 	s, _ := w.Submodule("test")
 	sr, _ := s.Repository()
 	h, _ := sr.ResolveRevision(plumbing.Revision(plumbing.NewBranchReferenceName("master")))
+	remoteHash, _ := c.GetHash("master", true)
+	origin, _ := c.r.Remote("origin")
 	tests := []struct {
 		name    string
 		client  Client
@@ -914,23 +921,59 @@ func TestClient_Info(t *testing.T) {
 			want: Info{
 				DirPath: p,
 				Current: hash,
+				Head:    "refs/heads/master",
 				BranchHashes: map[string]string{
 					"master": hash,
 				},
-				Status: []string{
-					"A  test",
-					"A  .gitmodules",
-					"",
+				Upstreams: map[string]string{"master": "origin/master"},
+				TagHashes: map[string]string{},
+				Remotes: map[string]RemoteInfo{
+					"origin": {
+						URLs:         origin.Config().URLs,
+						BranchHashes: map[string]string{"master": remoteHash},
+					},
+				},
+				Remote: &Info{
+					Current:      remoteHash,
+					BranchHashes: map[string]string{"master": remoteHash},
+				},
+				Status: Status{
+					Files: []FileStatus{
+						{Path: ".gitmodules", Staging: "A", Worktree: " "},
+						{Path: "test", Staging: "A", Worktree: " "},
+					},
+					Branch:   "master",
+					Upstream: "origin/master",
+					Ahead:    1,
+				},
+				Divergence: map[string]Divergence{
+					"master": {Upstream: "origin/master", MergeBase: remoteHash, Ahead: 1},
 				},
 				Submodules: map[string]Info{
 					"test": {
 						Current: h.String(),
 						DirPath: fmt.Sprintf("%s/test", p),
+						Head:    "refs/heads/master",
 						BranchHashes: map[string]string{
 							"master": h.String(),
 						},
+						Upstreams: map[string]string{"master": "origin/master"},
+						TagHashes: map[string]string{},
+						Remotes: map[string]RemoteInfo{
+							"origin": {
+								URLs:         []string{s.Config().URL},
+								BranchHashes: map[string]string{"master": h.String(), "test": h.String()},
+							},
+						},
+						Remote: &Info{
+							Current:      h.String(),
+							BranchHashes: map[string]string{"master": h.String(), "test": h.String()},
+						},
 						Submodules: map[string]Info{},
-						Status:     []string{""},
+						Status:     Status{Files: []FileStatus{}, Branch: "master", Upstream: "origin/master"},
+						Divergence: map[string]Divergence{
+							"master": {Upstream: "origin/master", MergeBase: h.String()},
+						},
 					},
 				},
 			},
@@ -948,6 +991,73 @@ func TestClient_Info(t *testing.T) {
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Errorf("Client.Info() mismatch (-want +got):\n%s", diff)
 			}
+			b1, err := json.Marshal(got)
+			if err != nil {
+				t.Errorf("json.Marshal() error = %v", err)
+			}
+			b2, _ := json.Marshal(tt.want)
+			if string(b1) != string(b2) {
+				t.Errorf("json.Marshal() is not stable: %s, %s", b1, b2)
+			}
 		})
 	}
 }
+
+func TestClient_Info_refs(t *testing.T) {
+	c := mockWithTags([]string{"v0.1", "v0.2"})
+	c.gitExec([]string{"checkout", "--detach", "v0.1"})
+	v1, _ := c.GetHash("v0.1", false)
+	v2, _ := c.GetHash("v0.2", false)
+	got, err := c.Info()
+	if err != nil {
+		t.Errorf("Client.Info() error = %v", err)
+		return
+	}
+	if !got.Detached || got.Head != "" || got.Current != v1 {
+		t.Errorf("Client.Info() head = %v %v %v, want detached at %v", got.Detached, got.Head, got.Current, v1)
+	}
+	if diff := cmp.Diff(map[string]string{"v0.1": v1, "v0.2": v2}, got.TagHashes); diff != "" {
+		t.Errorf("Client.Info() TagHashes mismatch (-want +got):\n%s", diff)
+	}
+	if got.Remote != nil || len(got.Remotes) != 0 || got.Shallow {
+		t.Errorf("Client.Info() = %v, want no remote", got)
+	}
+}
+
+func TestClient_Info_shallow(t *testing.T) {
+	src := mockWithHistory()
+	opt := mockOpt()
+	opt.OriginURL = src.opt.DirPath
+	c, err := Clone(opt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := src.mustHash("master")
+	got, err := c.Info()
+	if err != nil {
+		t.Fatalf("Client.Info() error = %v", err)
+	}
+	if !got.Shallow || got.Remote == nil || got.Remote.Current != master {
+		t.Errorf("Client.Info() = %v, want shallow with remote at %v", got, master)
+	}
+	if diff := cmp.Diff(map[string]Divergence{"master": {Upstream: "origin/master", MergeBase: master}}, got.Divergence); diff != "" {
+		t.Errorf("Client.Info() Divergence mismatch (-want +got):\n%s", diff)
+	}
+
+	src.CommitFiles(map[string][]byte{"fork": {1}}, "fork")
+	for _, args := range [][]string{{"remote", "add", "fork", src.opt.DirPath}, {"fetch", "-q", "--depth=1", "fork"}, {"branch", "-q", "-u", "fork/master"}} {
+		if out, err := c.gitExec(args); err != nil {
+			t.Fatalf("git %v: %v", args, out)
+		}
+	}
+	got, err = c.Info()
+	if err != nil {
+		t.Fatalf("Client.Info() error = %v", err)
+	}
+	if got.Remote == nil || got.Remote.Current != src.mustHash("master") || got.Upstreams["master"] != "fork/master" {
+		t.Errorf("Client.Info() = %v, want remote fork at %v", got, src.mustHash("master"))
+	}
+	if d := got.Divergence["master"]; !d.Unknown || d.State() != "unknown" {
+		t.Errorf("Client.Info() Divergence = %v, want unknown", d)
+	}
+}
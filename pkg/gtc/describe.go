@@ -0,0 +1,386 @@
+package gtc
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/pkg/errors"
+)
+
+// DescribeOpt follows the options of git describe.
+type DescribeOpt struct {
+	// Tags also uses lightweight tags.
+	Tags bool
+	// Match and Exclude are glob patterns of tag names.
+	Match   []string
+	Exclude []string
+	// Abbrev is the minimum length of the abbreviated hash, which is lengthened until it is
+	// unique like git. Zero means core.abbrev or a length growing with the number of packed
+	// objects, at least 7. Negative means --abbrev=0.
+	Abbrev int
+	Long   bool
+	// Always falls back to the abbreviated hash when no tag describes the commit.
+	Always bool
+	// Dirty marks a modified worktree. It can only describe HEAD.
+	Dirty bool
+	// Candidates is the number of tagged commits considered, like --candidates. Zero means 10.
+	Candidates int
+}
+
+type Description struct {
+	// Tag is empty when Always fell back to the hash.
+	Tag      string `json:"tag" yaml:"tag"`
+	Distance int    `json:"distance" yaml:"distance"`
+	Hash     string `json:"hash" yaml:"hash"`
+	Dirty    bool   `json:"dirty" yaml:"dirty"`
+	abbrev   int
+	long     bool
+}
+
+type describeName struct {
+	name      string
+	annotated bool
+	date      int64
+}
+
+// Describe names rev after the nearest tag like git describe. Empty rev means HEAD.
+func (c *Client) Describe(rev string, opt DescribeOpt) (Description, error) {
+	if opt.Dirty && rev != "" && rev != "HEAD" {
+		return Description{}, errors.New("dirty can not be used with a revision")
+	}
+	commit, err := c.resolveCommit(rev)
+	if err != nil {
+		return Description{}, err
+	}
+	ret := Description{Hash: commit.Hash.String(), abbrev: opt.Abbrev, long: opt.Long}
+	if ret.abbrev == 0 {
+		if ret.abbrev, err = c.defaultAbbrev(); err != nil {
+			return Description{}, err
+		}
+	}
+	if ret.abbrev > 0 {
+		if ret.abbrev, err = c.uniqueAbbrev(commit.Hash, ret.abbrev); err != nil {
+			return Description{}, err
+		}
+	}
+	if opt.Dirty {
+		clean, err := c.IsCleanWith(CleanOpt{IgnoreUntracked: true})
+		if err != nil {
+			return Description{}, err
+		}
+		ret.Dirty = !clean
+	}
+	names, err := c.describeNames(opt)
+	if err != nil {
+		return Description{}, err
+	}
+	if len(names) == 0 {
+		if opt.Always {
+			return ret, nil
+		}
+		return Description{}, errors.New("no names found, cannot describe anything")
+	}
+	candidates := opt.Candidates
+	if candidates <= 0 {
+		candidates = 10
+	}
+	if candidates > 64 {
+		candidates = 64
+	}
+	shallows, err := c.r.Storer.Shallow()
+	if err != nil {
+		return Description{}, err
+	}
+	shallow := map[plumbing.Hash]bool{}
+	for _, h := range shallows {
+		shallow[h] = true
+	}
+	tagged, distance, err := nearestDescribeName(commit, names, candidates, shallow)
+	if err != nil {
+		return Description{}, err
+	}
+	if tagged == nil {
+		if opt.Always {
+			return ret, nil
+		}
+		return Description{}, errors.Errorf("no tags can describe %s", ret.Hash)
+	}
+	ret.Tag, ret.Distance = names[tagged.Hash].name, distance
+	return ret, nil
+}
+
+// String formats the description the same way as git describe.
+func (d Description) String() string {
+	short := d.Hash
+	if d.abbrev > 0 && d.abbrev < len(short) {
+		short = short[:d.abbrev]
+	}
+	s := short
+	switch {
+	case d.Tag == "":
+	case d.abbrev < 0 || (d.Distance == 0 && !d.long):
+		s = d.Tag
+	default:
+		s = fmt.Sprintf("%s-%d-g%s", d.Tag, d.Distance, short)
+	}
+	if d.Dirty {
+		s += "-dirty"
+	}
+	return s
+}
+
+// defaultAbbrev returns core.abbrev, or like git a length which grows with the number of
+// packed objects so that abbreviations are unlikely to collide.
+func (c *Client) defaultAbbrev() (int, error) {
+	cfg, err := c.r.Config()
+	if err != nil {
+		return 0, err
+	}
+	switch v := cfg.Raw.Section("core").Option("abbrev"); v {
+	case "", "auto":
+	case "no":
+		return len(plumbing.ZeroHash) * 2, nil
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minAbbrev || n > len(plumbing.ZeroHash)*2 {
+			return 0, errors.Errorf("invalid core.abbrev %q", v)
+		}
+		return n, nil
+	}
+	count, err := c.packedObjectCount()
+	if err != nil {
+		return 0, err
+	}
+	// 2^bits objects are expected to collide at 2^(bits/2), and a hex digit holds 4 bits
+	n := (bits.Len(uint(count)) + 1) / 2
+	if n < 7 {
+		n = 7
+	}
+	return n, nil
+}
+
+// minAbbrev is the shortest abbreviation git accepts.
+const minAbbrev = 4
+
+// packedObjectCount sums the objects of all packfiles, like the approximate count of git.
+func (c *Client) packedObjectCount() (int, error) {
+	fs, ok := c.r.Storer.(*filesystem.Storage)
+	if !ok {
+		return 0, nil
+	}
+	dir := dotgit.New(fs.Filesystem())
+	packs, err := dir.ObjectPacks()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, h := range packs {
+		f, err := dir.ObjectPackIdx(h)
+		if err != nil {
+			return 0, err
+		}
+		idx := idxfile.NewMemoryIndex()
+		err = idxfile.NewDecoder(f).Decode(idx)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		n, err := idx.Count()
+		if err != nil {
+			return 0, err
+		}
+		count += int(n)
+	}
+	return count, nil
+}
+
+// uniqueAbbrev returns the length of the shortest prefix of h, at least n hex digits,
+// which no other object in the repository shares.
+func (c *Client) uniqueAbbrev(h plumbing.Hash, n int) (int, error) {
+	if n < minAbbrev {
+		n = minAbbrev
+	}
+	full := h.String()
+	if n >= len(full) {
+		return len(full), nil
+	}
+	others, err := c.hashesWithPrefix(h[:n/2])
+	if err != nil {
+		return 0, err
+	}
+	for _, o := range others {
+		if o == h {
+			continue
+		}
+		s := o.String()
+		for n < len(full) && s[:n] == full[:n] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// hashesWithPrefix lists the loose and packed objects starting with prefix.
+func (c *Client) hashesWithPrefix(prefix []byte) ([]plumbing.Hash, error) {
+	if fs, ok := c.r.Storer.(*filesystem.Storage); ok {
+		// the pack indexes are loaded lazily on the first packed lookup
+		if err := fs.HasEncodedObject(plumbing.ZeroHash); err != nil && err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+		return fs.HashesWithPrefix(prefix)
+	}
+	iter, err := c.r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return nil, err
+	}
+	ret := []plumbing.Hash{}
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if h := obj.Hash(); bytes.HasPrefix(h[:], prefix) {
+			ret = append(ret, h)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// describeNames picks one tag per commit. Annotated tags win over lightweight tags,
+// then the newest tagger date, then the first name.
+func (c *Client) describeNames(opt DescribeOpt) (map[plumbing.Hash]describeName, error) {
+	tags, err := c.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	ret := map[plumbing.Hash]describeName{}
+	for _, tag := range tags {
+		if !tag.Annotated && !opt.Tags {
+			continue
+		}
+		if (len(opt.Match) > 0 && !matchAny(tag.Name, opt.Match)) || matchAny(tag.Name, opt.Exclude) {
+			continue
+		}
+		n := describeName{name: tag.Name, annotated: tag.Annotated}
+		if tag.Tagger != nil {
+			n.date = tag.Tagger.When.Unix()
+		}
+		h := plumbing.NewHash(tag.Hash)
+		cur, ok := ret[h]
+		if !ok || (n.annotated && !cur.annotated) || (n.annotated && cur.annotated && n.date > cur.date) {
+			ret[h] = n
+		}
+	}
+	return ret, nil
+}
+
+// nearestDescribeName walks from start newest first like git describe and returns the
+// tagged commit with the fewest commits on top of it, preferring the one met first. Only the
+// first candidates tagged commits are considered and shallow commits end the history.
+func nearestDescribeName(start *object.Commit, names map[plumbing.Hash]describeName, candidates int, shallow map[plumbing.Hash]bool) (*object.Commit, int, error) {
+	if _, ok := names[start.Hash]; ok {
+		return start, 0, nil
+	}
+	type match struct {
+		commit *object.Commit
+		depth  int
+		flag   uint64
+	}
+	matches := []*match{}
+	// flags has the bits of the matches each commit is reachable from
+	flags := map[plumbing.Hash]uint64{}
+	seen := map[plumbing.Hash]bool{start.Hash: true}
+	queue := []*object.Commit{start}
+	push := func(commit *object.Commit) {
+		i := 0
+		for i < len(queue) && !commit.Committer.When.After(queue[i].Committer.When) {
+			i++
+		}
+		queue = append(queue, nil)
+		copy(queue[i+1:], queue[i:])
+		queue[i] = commit
+	}
+	visit := func(commit *object.Commit) error {
+		if shallow[commit.Hash] {
+			return nil
+		}
+		return commit.Parents().ForEach(func(p *object.Commit) error {
+			if !seen[p.Hash] {
+				seen[p.Hash] = true
+				push(p)
+			}
+			flags[p.Hash] |= flags[commit.Hash]
+			return nil
+		})
+	}
+	var gaveUp *object.Commit
+	for popped := 0; len(queue) > 0; {
+		commit := queue[0]
+		queue = queue[1:]
+		popped++
+		if _, ok := names[commit.Hash]; ok {
+			if len(matches) == candidates {
+				gaveUp = commit
+				break
+			}
+			m := &match{commit: commit, depth: popped - 1, flag: 1 << uint(len(matches))}
+			matches = append(matches, m)
+			flags[commit.Hash] |= m.flag
+		}
+		for _, m := range matches {
+			if flags[commit.Hash]&m.flag == 0 {
+				m.depth++
+			}
+		}
+		if err := visit(commit); err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(matches) == 0 {
+		return nil, 0, nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].depth < matches[j].depth })
+	best := matches[0]
+	if gaveUp != nil {
+		push(gaveUp)
+	}
+	// finish counting the commits not reachable from best until only its history is left
+	for len(queue) > 0 {
+		commit := queue[0]
+		queue = queue[1:]
+		if flags[commit.Hash]&best.flag != 0 {
+			within := true
+			for _, q := range queue {
+				if flags[q.Hash]&best.flag == 0 {
+					within = false
+					break
+				}
+			}
+			if within {
+				break
+			}
+		} else {
+			best.depth++
+		}
+		if err := visit(commit); err != nil {
+			return nil, 0, err
+		}
+	}
+	return best.commit, best.depth, nil
+}
+
+func matchAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
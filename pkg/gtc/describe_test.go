@@ -0,0 +1,152 @@
+package gtc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func mockForDescribe() Client {
+	c := mockInit()
+	when := time.Now()
+	tagger := func(d int) *Signature {
+		return &Signature{Name: "bob", Email: "bob@mail.com", When: when.AddDate(0, 0, d)}
+	}
+	c.CommitFiles(map[string][]byte{"a": {1}}, "a")
+	c.CreateTag("v1.0.0", "HEAD", CreateTagOpt{Message: "v1.0.0", Tagger: tagger(1)})
+	c.CreateTag("v1.0.0-rc", "HEAD", CreateTagOpt{Message: "v1.0.0-rc", Tagger: tagger(0)})
+	c.CommitFiles(map[string][]byte{"b": {1}}, "b")
+	c.CreateTag("light", "HEAD", CreateTagOpt{})
+	c.CreateBranch("topic", false)
+	c.CommitFiles(map[string][]byte{"c": {1}}, "c")
+	c.CreateTag("v1.1.0", "HEAD", CreateTagOpt{Message: "v1.1.0", Tagger: tagger(2)})
+	c.Checkout("master", false)
+	c.CommitFiles(map[string][]byte{"d": {1}}, "d")
+	c.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "merge", "--no-ff", "-m", "merge topic", "topic"})
+	c.CommitFiles(map[string][]byte{"e": {1}}, "e")
+	return c
+}
+
+func TestClient_Describe(t *testing.T) {
+	c := mockForDescribe()
+	tests := []struct {
+		name    string
+		rev     string
+		opt     DescribeOpt
+		args    []string
+		dirty   bool
+		wantErr bool
+	}{
+		{name: "annotated", args: []string{}},
+		{name: "tags", opt: DescribeOpt{Tags: true}, args: []string{"--tags"}},
+		{name: "long", rev: "v1.1.0", opt: DescribeOpt{Long: true}, args: []string{"--long", "v1.1.0"}},
+		{name: "exact", rev: "v1.0.0", args: []string{"v1.0.0"}},
+		{name: "match", opt: DescribeOpt{Match: []string{"v1.0*"}}, args: []string{"--match", "v1.0*"}},
+		{name: "exclude", opt: DescribeOpt{Tags: true, Exclude: []string{"v*"}}, args: []string{"--tags", "--exclude", "v*"}},
+		{name: "abbrev", opt: DescribeOpt{Abbrev: 12}, args: []string{"--abbrev=12"}},
+		{name: "abbrev_0", opt: DescribeOpt{Abbrev: -1}, args: []string{"--abbrev=0"}},
+		{name: "always", opt: DescribeOpt{Match: []string{"none"}, Always: true}, args: []string{"--match", "none", "--always"}},
+		{name: "dirty", opt: DescribeOpt{Dirty: true}, args: []string{"--dirty"}, dirty: true},
+		{name: "candidates", opt: DescribeOpt{Tags: true, Candidates: 1}, args: []string{"--tags", "--candidates=1"}},
+		{name: "candidates_topic", rev: "topic", opt: DescribeOpt{Tags: true, Candidates: 2}, args: []string{"--tags", "--candidates=2", "topic"}},
+		{name: "ng_no_names", opt: DescribeOpt{Match: []string{"none"}}, wantErr: true},
+		{name: "ng_dirty_rev", rev: "v1.0.0", opt: DescribeOpt{Dirty: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dirty {
+				ioutil.WriteFile(c.opt.DirPath+"/a", []byte{2}, 0644)
+				defer ioutil.WriteFile(c.opt.DirPath+"/a", []byte{1}, 0644)
+			}
+			got, err := c.Describe(tt.rev, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Describe() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			out, err := c.gitExec(append([]string{"describe"}, tt.args...))
+			if err != nil {
+				t.Fatalf("git describe failed: %v", out)
+			}
+			if got.String() != out[0] {
+				t.Errorf("Client.Describe() = %v, want %v", got, out[0])
+			}
+		})
+	}
+}
+
+func TestClient_Describe_shallow(t *testing.T) {
+	src := mockForDescribe()
+	opt := mockOpt()
+	opt.OriginURL = src.opt.DirPath
+	c, err := Clone(opt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(c.opt.DirPath+"/a", []byte{2}, 0644)
+	got, err := c.Describe("", DescribeOpt{Tags: true, Always: true, Dirty: true})
+	if err != nil {
+		t.Fatalf("Client.Describe() error = %v", err)
+	}
+	out, err := c.gitExec([]string{"describe", "--tags", "--always", "--dirty"})
+	if err != nil {
+		t.Fatalf("git describe failed: %v", out)
+	}
+	if got.String() != out[0] {
+		t.Errorf("Client.Describe() = %v, want %v", got, out[0])
+	}
+}
+
+func TestClient_Describe_ambiguous(t *testing.T) {
+	c := mockForDescribe()
+	head := c.mustHash("HEAD")
+	// a blob sharing the first 5 hex digits of HEAD makes a 4 digit abbreviation ambiguous
+	var blob []byte
+	for i := 0; ; i++ {
+		blob = []byte(fmt.Sprintf("collision %d\n", i))
+		if plumbing.ComputeHash(plumbing.BlobObject, blob).String()[:5] == head[:5] {
+			break
+		}
+	}
+	ioutil.WriteFile(c.opt.DirPath+"/collision", blob, 0644)
+	if out, err := c.gitExec([]string{"hash-object", "-w", "collision"}); err != nil || !strings.HasPrefix(out[0], head[:5]) {
+		t.Fatalf("git hash-object: %v", out)
+	}
+	for _, step := range []string{"loose", "packed", "core_abbrev"} {
+		t.Run(step, func(t *testing.T) {
+			switch step {
+			case "packed":
+				c.gitExec([]string{"repack", "-adq"})
+			case "core_abbrev":
+				c.gitExec([]string{"config", "core.abbrev", "9"})
+			}
+			c, err := Open(c.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, abbrev := range []int{0, 4} {
+				got, err := c.Describe("", DescribeOpt{Abbrev: abbrev})
+				if err != nil {
+					t.Fatalf("Client.Describe() error = %v", err)
+				}
+				args := []string{"describe"}
+				if abbrev > 0 {
+					args = append(args, fmt.Sprintf("--abbrev=%d", abbrev))
+				}
+				out, err := c.gitExec(args)
+				if err != nil {
+					t.Fatalf("git describe failed: %v", out)
+				}
+				if got.String() != out[0] {
+					t.Errorf("Client.Describe() with abbrev %d = %v, want %v", abbrev, got, out[0])
+				}
+			}
+		})
+	}
+}
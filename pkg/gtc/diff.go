@@ -0,0 +1,462 @@
+package gtc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/pkg/errors"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffIndex and DiffWorktree can be given to Diff instead of a revision.
+const (
+	DiffIndex    = "<index>"
+	DiffWorktree = "<worktree>"
+	// diffEmptyTree compares against nothing, e.g. for root commits.
+	diffEmptyTree = "<empty>"
+)
+
+type DiffAction string
+
+const (
+	DiffAdded    DiffAction = "added"
+	DiffModified DiffAction = "modified"
+	DiffDeleted  DiffAction = "deleted"
+	DiffRenamed  DiffAction = "renamed"
+	// DiffUnmerged is a path with conflict stages in the index, reported without a patch
+	// like the "Unmerged path" of git diff. FromHash and ToHash are ours and theirs.
+	DiffUnmerged DiffAction = "unmerged"
+)
+
+type DiffOpt struct {
+	// Paths limits the diff to these files or directories.
+	Paths []string
+	// DetectRenames pairs deleted and added files with identical content.
+	DetectRenames bool
+	// Context is the number of context lines in patches. Nil means 3.
+	Context *int
+	// NoPatch skips generating patch text and line stats.
+	NoPatch bool
+}
+
+type FileDiff struct {
+	Action    DiffAction
+	From      string
+	To        string
+	FromHash  string
+	ToHash    string
+	Binary    bool
+	Additions int
+	Deletions int
+	Patch     string
+}
+
+type diffEntry struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+	read func() ([]byte, error)
+	// stages holds the conflict stages of an unmerged index path.
+	stages map[index.Stage]*diffEntry
+}
+
+// Diff compares two revisions, the index or the worktree like `git diff from to`.
+func (c *Client) Diff(from, to string, opt DiffOpt) ([]FileDiff, error) {
+	if c.r == nil {
+		return nil, errors.New("this repository is not initialized")
+	}
+	src, err := c.diffEntries(from)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := c.diffEntries(to)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, p := range opt.Paths {
+		paths = append(paths, cleanPath(p))
+	}
+	ret := []FileDiff{}
+	added, deleted := []*diffEntry{}, map[plumbing.Hash][]*diffEntry{}
+	for name, s := range src {
+		if !matchPaths(name, paths) {
+			continue
+		}
+		d, ok := dst[name]
+		switch {
+		case s.stages != nil || ok && d.stages != nil:
+			ret = append(ret, newUnmergedDiff(s, d))
+		case !ok:
+			if opt.DetectRenames {
+				deleted[s.hash] = append(deleted[s.hash], s)
+				continue
+			}
+			fd, err := newFileDiff(DiffDeleted, s, nil, opt)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, fd)
+		case s.hash != d.hash || s.mode != d.mode:
+			fd, err := newFileDiff(DiffModified, s, d, opt)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, fd)
+		}
+	}
+	for name, d := range dst {
+		if _, ok := src[name]; ok || !matchPaths(name, paths) {
+			continue
+		}
+		if d.stages != nil {
+			ret = append(ret, newUnmergedDiff(nil, d))
+			continue
+		}
+		added = append(added, d)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].path < added[j].path })
+	for _, d := range added {
+		action, s := DiffAdded, (*diffEntry)(nil)
+		if candidates := deleted[d.hash]; len(candidates) > 0 {
+			action, s = DiffRenamed, candidates[0]
+			deleted[d.hash] = candidates[1:]
+		}
+		fd, err := newFileDiff(action, s, d, opt)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, fd)
+	}
+	for _, candidates := range deleted {
+		for _, s := range candidates {
+			fd, err := newFileDiff(DiffDeleted, s, nil, opt)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, fd)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].path() < ret[j].path() })
+	return ret, nil
+}
+
+func (d FileDiff) path() string {
+	if d.To != "" {
+		return d.To
+	}
+	return d.From
+}
+
+func matchPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == "" || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) diffEntries(target string) (map[string]*diffEntry, error) {
+	switch target {
+	case DiffIndex:
+		return c.indexEntries()
+	case DiffWorktree:
+		return c.worktreeEntries()
+	case diffEmptyTree:
+		return map[string]*diffEntry{}, nil
+	}
+	commit, err := c.resolveCommit(target)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return c.treeEntries(tree)
+}
+
+func (c *Client) treeEntries(tree *object.Tree) (map[string]*diffEntry, error) {
+	ret := map[string]*diffEntry{}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		ret[name] = c.blobEntry(name, entry.Hash, entry.Mode)
+	}
+	return ret, nil
+}
+
+func (c *Client) indexEntries() (map[string]*diffEntry, error) {
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]*diffEntry{}
+	for _, e := range idx.Entries {
+		if e.Stage == 0 {
+			ret[e.Name] = c.blobEntry(e.Name, e.Hash, e.Mode)
+			continue
+		}
+		if ret[e.Name] == nil {
+			ret[e.Name] = &diffEntry{path: e.Name, stages: map[index.Stage]*diffEntry{}}
+		}
+		ret[e.Name].stages[e.Stage] = c.blobEntry(e.Name, e.Hash, e.Mode)
+	}
+	return ret, nil
+}
+
+// newUnmergedDiff reports the unmerged path of either side instead of comparing its stages.
+func newUnmergedDiff(from, to *diffEntry) FileDiff {
+	unmerged := from
+	if unmerged == nil || unmerged.stages == nil {
+		unmerged = to
+	}
+	ret := FileDiff{Action: DiffUnmerged, From: unmerged.path, To: unmerged.path}
+	if ours := unmerged.stages[index.OurMode]; ours != nil {
+		ret.FromHash = ours.hash.String()
+	}
+	if theirs := unmerged.stages[index.TheirMode]; theirs != nil {
+		ret.ToHash = theirs.hash.String()
+	}
+	return ret
+}
+
+// worktreeEntries reads the tracked files from disk, as `git diff` does.
+func (c *Client) worktreeEntries() (map[string]*diffEntry, error) {
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]*diffEntry{}
+	for _, e := range idx.Entries {
+		// the conflict stages of an unmerged path share one worktree file
+		if _, ok := ret[e.Name]; ok {
+			continue
+		}
+		fullPath := filepath.Join(c.opt.DirPath, e.Name)
+		fi, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.Mode == filemode.Submodule {
+			h := e.Hash
+			if sr, err := git.PlainOpen(fullPath); err == nil {
+				if head, err := sr.Head(); err == nil {
+					h = head.Hash()
+				}
+			}
+			ret[e.Name] = c.blobEntry(e.Name, h, e.Mode)
+			continue
+		}
+		var content []byte
+		mode := filemode.Regular
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(fullPath)
+			if err != nil {
+				return nil, err
+			}
+			content, mode = []byte(target), filemode.Symlink
+		default:
+			content, err = ioutil.ReadFile(fullPath)
+			if err != nil {
+				return nil, err
+			}
+			if fi.Mode()&0111 != 0 {
+				mode = filemode.Executable
+			}
+		}
+		ret[e.Name] = &diffEntry{
+			path: e.Name,
+			hash: plumbing.ComputeHash(plumbing.BlobObject, content),
+			mode: mode,
+			read: func() ([]byte, error) { return content, nil },
+		}
+	}
+	return ret, nil
+}
+
+func (c *Client) blobEntry(name string, hash plumbing.Hash, mode filemode.FileMode) *diffEntry {
+	return &diffEntry{
+		path: name,
+		hash: hash,
+		mode: mode,
+		read: func() ([]byte, error) {
+			if mode == filemode.Submodule {
+				return []byte(fmt.Sprintf("Subproject commit %s\n", hash)), nil
+			}
+			blob, err := c.r.BlobObject(hash)
+			if err != nil {
+				return nil, err
+			}
+			r, err := blob.Reader()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return ioutil.ReadAll(r)
+		},
+	}
+}
+
+func newFileDiff(action DiffAction, from, to *diffEntry, opt DiffOpt) (FileDiff, error) {
+	ret := FileDiff{Action: action}
+	fp := &filePatch{}
+	var src, dst []byte
+	if from != nil {
+		ret.From, ret.FromHash = from.path, from.hash.String()
+		fp.from = from
+	}
+	if to != nil {
+		ret.To, ret.ToHash = to.path, to.hash.String()
+		fp.to = to
+	}
+	if opt.NoPatch {
+		return ret, nil
+	}
+	var err error
+	if from != nil {
+		if src, err = from.read(); err != nil {
+			return FileDiff{}, err
+		}
+	}
+	if to != nil {
+		if dst, err = to.read(); err != nil {
+			return FileDiff{}, err
+		}
+	}
+	if ret.Binary, err = isBinary(src, dst); err != nil {
+		return FileDiff{}, err
+	}
+	fp.binary = ret.Binary
+	if !ret.Binary && (from == nil || to == nil || from.hash != to.hash) {
+		for _, d := range diff.Do(string(src), string(dst)) {
+			lines := strings.Count(d.Text, "\n")
+			if !strings.HasSuffix(d.Text, "\n") {
+				lines++
+			}
+			switch d.Type {
+			case diffmatchpatch.DiffInsert:
+				ret.Additions += lines
+				fp.chunks = append(fp.chunks, chunk{d.Text, fdiff.Add})
+			case diffmatchpatch.DiffDelete:
+				ret.Deletions += lines
+				fp.chunks = append(fp.chunks, chunk{d.Text, fdiff.Delete})
+			default:
+				fp.chunks = append(fp.chunks, chunk{d.Text, fdiff.Equal})
+			}
+		}
+	}
+	ctxLines := 3
+	if opt.Context != nil {
+		ctxLines = *opt.Context
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := fdiff.NewUnifiedEncoder(buf, ctxLines).Encode(patch{fp}); err != nil {
+		return FileDiff{}, err
+	}
+	ret.Patch = buf.String()
+	return ret, nil
+}
+
+func isBinary(blobs ...[]byte) (bool, error) {
+	for _, b := range blobs {
+		ok, err := binary.IsBinary(bytes.NewReader(b))
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type patch []fdiff.FilePatch
+
+func (p patch) FilePatches() []fdiff.FilePatch {
+	return p
+}
+
+func (p patch) Message() string {
+	return ""
+}
+
+type filePatch struct {
+	from   *diffEntry
+	to     *diffEntry
+	binary bool
+	chunks []fdiff.Chunk
+}
+
+func (p *filePatch) IsBinary() bool {
+	return p.binary
+}
+
+func (p *filePatch) Files() (fdiff.File, fdiff.File) {
+	var from, to fdiff.File
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+func (p *filePatch) Chunks() []fdiff.Chunk {
+	return p.chunks
+}
+
+func (e *diffEntry) Hash() plumbing.Hash {
+	return e.hash
+}
+
+func (e *diffEntry) Mode() filemode.FileMode {
+	return e.mode
+}
+
+func (e *diffEntry) Path() string {
+	return e.path
+}
+
+type chunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c chunk) Content() string {
+	return c.content
+}
+
+func (c chunk) Type() fdiff.Operation {
+	return c.op
+}
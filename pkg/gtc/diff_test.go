@@ -0,0 +1,155 @@
+package gtc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestClient_Diff(t *testing.T) {
+	c := mockWithHistory()
+	dirty := mockWithHistory()
+	os.WriteFile(dirty.opt.DirPath+"/renamed.txt", []byte("a\nB\nc\nd\n"), 0644)
+	os.Remove(dirty.opt.DirPath + "/dir/b.txt")
+	staged := mockInit()
+	staged.addFile("file", []byte{0, 1})
+	staged.Add("file")
+	staged.addFile("new.txt", []byte("new\n"))
+	staged.Add("new.txt")
+	conflict := mockWithConflict()
+	zero := 0
+	type args struct {
+		from string
+		to   string
+		opt  DiffOpt
+	}
+	tests := []struct {
+		name    string
+		client  Client
+		args    args
+		want    []FileDiff
+		wantErr bool
+	}{
+		{
+			name:   "ok_revisions",
+			client: c,
+			args:   args{from: "HEAD~1", to: "HEAD"},
+			want: []FileDiff{
+				{
+					Action:    DiffModified,
+					From:      "renamed.txt",
+					To:        "renamed.txt",
+					Additions: 1,
+					Patch: "diff --git a/renamed.txt b/renamed.txt\n" +
+						"index de980441c3ab03a8c07dda1ad27b8a11f39deb1e..d68dd4031d2ad5b7a3829ad7df6635e27a7daa22 100644\n" +
+						"--- a/renamed.txt\n" +
+						"+++ b/renamed.txt\n" +
+						"@@ -1,3 +1,4 @@\n a\n b\n c\n+d\n",
+				},
+			},
+		},
+		{
+			name:   "ok_zero_context",
+			client: c,
+			args:   args{from: "HEAD~1", to: "HEAD", opt: DiffOpt{Context: &zero}},
+			want: []FileDiff{
+				{
+					Action:    DiffModified,
+					From:      "renamed.txt",
+					To:        "renamed.txt",
+					Additions: 1,
+					Patch: "diff --git a/renamed.txt b/renamed.txt\n" +
+						"index de980441c3ab03a8c07dda1ad27b8a11f39deb1e..d68dd4031d2ad5b7a3829ad7df6635e27a7daa22 100644\n" +
+						"--- a/renamed.txt\n" +
+						"+++ b/renamed.txt\n" +
+						"@@ -3,0 +4 @@ c\n+d\n",
+				},
+			},
+		},
+		{
+			name:   "ok_without_renames",
+			client: c,
+			args:   args{from: "HEAD~2", to: "HEAD~1", opt: DiffOpt{NoPatch: true}},
+			want: []FileDiff{
+				{Action: DiffDeleted, From: "a.txt"},
+				{Action: DiffAdded, To: "renamed.txt"},
+			},
+		},
+		{
+			name:   "ok_detect_renames",
+			client: c,
+			args:   args{from: "HEAD~2", to: "HEAD~1", opt: DiffOpt{NoPatch: true, DetectRenames: true}},
+			want: []FileDiff{
+				{Action: DiffRenamed, From: "a.txt", To: "renamed.txt"},
+			},
+		},
+		{
+			name:   "ok_paths",
+			client: c,
+			args:   args{from: "HEAD~4", to: "HEAD", opt: DiffOpt{NoPatch: true, Paths: []string{"dir"}}},
+			want: []FileDiff{
+				{Action: DiffAdded, To: "dir/b.txt"},
+			},
+		},
+		{
+			name:   "ok_worktree",
+			client: dirty,
+			args:   args{from: DiffIndex, to: DiffWorktree},
+			want: []FileDiff{
+				{Action: DiffDeleted, From: "dir/b.txt", Deletions: 1},
+				{Action: DiffModified, From: "renamed.txt", To: "renamed.txt", Additions: 1, Deletions: 1},
+			},
+		},
+		{
+			name:   "ok_index",
+			client: staged,
+			args:   args{from: "HEAD", to: DiffIndex},
+			want: []FileDiff{
+				{Action: DiffModified, From: "file", To: "file", Binary: true},
+				{Action: DiffAdded, To: "new.txt", Additions: 1},
+			},
+		},
+		{
+			name:   "ok_unmerged_index",
+			client: conflict,
+			args:   args{from: "HEAD", to: DiffIndex},
+			want:   []FileDiff{{Action: DiffUnmerged, From: "file", To: "file"}},
+		},
+		{
+			name:   "ok_unmerged_worktree",
+			client: conflict,
+			args:   args{from: DiffIndex, to: DiffWorktree},
+			want:   []FileDiff{{Action: DiffUnmerged, From: "file", To: "file"}},
+		},
+		{
+			name:    "ng_revision",
+			client:  c,
+			args:    args{from: "no-rev", to: "HEAD"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			got, err := c.Diff(tt.args.from, tt.args.to, tt.args.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Diff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			ignore := cmpopts.IgnoreFields(FileDiff{}, "FromHash", "ToHash")
+			if tt.want != nil && tt.want[0].Patch == "" {
+				ignore = cmpopts.IgnoreFields(FileDiff{}, "FromHash", "ToHash", "Patch")
+			}
+			if diff := cmp.Diff(tt.want, got, ignore); !tt.wantErr && diff != "" {
+				t.Errorf("Client.Diff() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	// every conflict stage is kept instead of the last one overwriting the others
+	got, err := conflict.Diff("HEAD", DiffIndex, DiffOpt{})
+	if err != nil || len(got) != 1 || got[0].FromHash != gitRevParse(t, conflict, ":2:file") || got[0].ToHash != gitRevParse(t, conflict, ":3:file") {
+		t.Errorf("Client.Diff() of an unmerged path = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,380 @@
+package gtc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/pkg/errors"
+)
+
+type ReadFilesOpt struct {
+	// Paths are files or directories relative to DirPath. Empty means the whole worktree.
+	Paths []string
+	// Include and Exclude are glob patterns matched against the slash separated path
+	// relative to DirPath. "**" matches any number of directories.
+	Include []string
+	Exclude []string
+	// Gitignore skips untracked files matched by .gitignore and .git/info/exclude.
+	Gitignore bool
+	// TrackedOnly reads only files in the index.
+	TrackedOnly bool
+	// RefuseOutsideLinks fails on symlinks whose target is outside DirPath.
+	RefuseOutsideLinks bool
+	AbsolutePath       bool
+}
+
+// ErrLinkOutside is the cause of a FileError for a symlink pointing outside DirPath.
+var ErrLinkOutside = errors.New("symlink target is outside the repository")
+
+// FileError reports a file that could not be walked or read. Err is the cause,
+// e.g. os.ErrNotExist, os.ErrPermission or ErrLinkOutside.
+type FileError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+func (e *FileError) Cause() error { return e.Err }
+
+// WalkOpt filters the files met by WalkFiles and WalkFilesAt.
+type WalkOpt struct {
+	ReadFilesOpt
+	// MaxSize skips files larger than MaxSize bytes. Zero means no limit.
+	MaxSize int64
+	// DetectBinary sets FileEntry.Binary. SkipBinary skips binary files.
+	DetectBinary bool
+	SkipBinary   bool
+}
+
+// FileEntry is a file met by a walk. The content is read only when Open is called.
+// Symlinks are not followed. Link holds the target and Open reads it like git stores it.
+type FileEntry struct {
+	Path   string      `json:"path" yaml:"path"`
+	Mode   os.FileMode `json:"mode" yaml:"mode"`
+	Size   int64       `json:"size" yaml:"size"`
+	Binary bool        `json:"binary" yaml:"binary"`
+	Link   string      `json:"link,omitempty" yaml:"link,omitempty"`
+	open   func() (io.ReadCloser, error)
+}
+
+func (f FileEntry) Open() (io.ReadCloser, error) {
+	return f.open()
+}
+
+// ReadFilesWith reads worktree files filtered by opt. The .git directory is always skipped.
+func (c *Client) ReadFilesWith(opt ReadFilesOpt) (map[string][]byte, error) {
+	return readEntries(func(fn func(FileEntry) error) error {
+		return c.walkFiles(WalkOpt{ReadFilesOpt: opt}, nil, fn)
+	})
+}
+
+// ReadFilesAt reads files from the tree of rev without touching the worktree.
+// rev can be a branch, tag, remote tracking branch or hash. Gitignore, TrackedOnly and
+// AbsolutePath do not apply to a revision and are ignored.
+func (c *Client) ReadFilesAt(rev string, opt ReadFilesOpt) (map[string][]byte, error) {
+	return readEntries(func(fn func(FileEntry) error) error {
+		return c.WalkFilesAt(rev, WalkOpt{ReadFilesOpt: opt}, fn)
+	})
+}
+
+// WalkFiles calls fn for each worktree file filtered by opt. fn can return storer.ErrStop to stop.
+func (c *Client) WalkFiles(opt WalkOpt, fn func(FileEntry) error) error {
+	return c.walkFiles(opt, nil, fn)
+}
+
+// WalkFilesAt calls fn for each file in the tree of rev filtered by opt.
+// fn can return storer.ErrStop to stop.
+func (c *Client) WalkFilesAt(rev string, opt WalkOpt, fn func(FileEntry) error) error {
+	commit, err := c.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !underPaths(f.Name, opt.Paths) ||
+			(len(opt.Include) > 0 && !matchPathGlobs(f.Name, opt.Include)) ||
+			matchPathGlobs(f.Name, opt.Exclude) {
+			return nil
+		}
+		mode, err := f.Mode.ToOSFileMode()
+		if err != nil {
+			return err
+		}
+		name, blob := f.Name, f.Blob
+		entry := FileEntry{Path: name, Mode: mode, Size: f.Size, open: func() (io.ReadCloser, error) {
+			r, err := blob.Reader()
+			if err != nil {
+				return nil, &FileError{Op: "read", Path: name, Err: err}
+			}
+			return r, nil
+		}}
+		if f.Mode == filemode.Symlink {
+			if entry.Link, err = f.Contents(); err != nil {
+				return &FileError{Op: "read", Path: name, Err: err}
+			}
+		}
+		return walkEntry(entry, opt, fn)
+	})
+	if err == storer.ErrStop {
+		return nil
+	}
+	return err
+}
+
+// walkFiles walks opt.Paths. skip is an extra filter given the base name of a file or directory.
+func (c *Client) walkFiles(opt WalkOpt, skip func(name string, dir bool) bool, fn func(FileEntry) error) error {
+	paths := opt.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var tracked map[string]bool
+	var ignore gitignore.Matcher
+	if opt.Gitignore || opt.TrackedOnly {
+		idx, err := c.r.Storer.Index()
+		if err != nil {
+			return err
+		}
+		tracked = map[string]bool{}
+		for _, e := range idx.Entries {
+			tracked[e.Name] = true
+			for d := path.Dir(e.Name); d != "."; d = path.Dir(d) {
+				tracked[d+"/"] = true
+			}
+		}
+	}
+	if opt.Gitignore {
+		w, err := c.r.Worktree()
+		if err != nil {
+			return err
+		}
+		if ignore, err = c.ignoreMatcher(w); err != nil {
+			return err
+		}
+	}
+	for _, p := range paths {
+		root := filepath.Join(c.opt.DirPath, p)
+		if _, err := os.Lstat(root); err != nil {
+			return &FileError{Op: "stat", Path: p, Err: pathErrorCause(err)}
+		}
+		err := filepath.Walk(root, func(fp string, info os.FileInfo, e error) error {
+			rel, err := filepath.Rel(c.opt.DirPath, fp)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if e != nil {
+				return &FileError{Op: "walk", Path: rel, Err: pathErrorCause(e)}
+			}
+			if info.Name() == ".git" && rel != "." {
+				// a .git file or link is the gitdir pointer of a submodule or worktree
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if rel == "." {
+					return nil
+				}
+				switch {
+				case skip != nil && skip(info.Name(), true),
+					matchPathGlobs(rel, opt.Exclude),
+					opt.TrackedOnly && !tracked[rel+"/"],
+					ignore != nil && !tracked[rel+"/"] && ignore.Match(strings.Split(rel, "/"), true):
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch {
+			case skip != nil && skip(info.Name(), false),
+				len(opt.Include) > 0 && !matchPathGlobs(rel, opt.Include),
+				matchPathGlobs(rel, opt.Exclude),
+				opt.TrackedOnly && !tracked[rel],
+				ignore != nil && !tracked[rel] && ignore.Match(strings.Split(rel, "/"), false):
+				return nil
+			}
+			name := rel
+			if opt.AbsolutePath {
+				name = filepath.Join(c.opt.DirPath, rel)
+			}
+			entry := FileEntry{Path: name, Mode: info.Mode(), Size: info.Size(), open: func() (io.ReadCloser, error) {
+				f, err := os.Open(fp)
+				if err != nil {
+					return nil, &FileError{Op: "open", Path: rel, Err: pathErrorCause(err)}
+				}
+				return f, nil
+			}}
+			if info.Mode()&os.ModeSymlink != 0 {
+				if entry.Link, err = c.readLink(fp, opt.RefuseOutsideLinks); err != nil {
+					return &FileError{Op: "readlink", Path: rel, Err: err}
+				}
+				link := entry.Link
+				entry.open = func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(strings.NewReader(link)), nil
+				}
+			}
+			return walkEntry(entry, opt, fn)
+		})
+		if err == storer.ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLink returns the target of the symlink at fp. With refuseOutside, targets resolving
+// outside DirPath fail with ErrLinkOutside.
+func (c *Client) readLink(fp string, refuseOutside bool) (string, error) {
+	link, err := os.Readlink(fp)
+	if err != nil {
+		return "", pathErrorCause(err)
+	}
+	if !refuseOutside {
+		return link, nil
+	}
+	root, err := filepath.EvalSymlinks(c.opt.DirPath)
+	if err != nil {
+		return "", pathErrorCause(err)
+	}
+	target, err := filepath.EvalSymlinks(fp)
+	if os.IsNotExist(err) {
+		// A dangling link is checked lexically.
+		target = link
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(fp), target)
+		}
+		if target, err = filepath.Rel(c.opt.DirPath, target); err == nil {
+			target = filepath.Join(root, target)
+		}
+	}
+	if err != nil {
+		return "", pathErrorCause(err)
+	}
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrLinkOutside
+	}
+	return link, nil
+}
+
+// pathErrorCause unwraps *os.PathError so FileError does not repeat the path.
+func pathErrorCause(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// walkEntry applies the size and binary filters before calling fn.
+func walkEntry(f FileEntry, opt WalkOpt, fn func(FileEntry) error) error {
+	if opt.MaxSize > 0 && f.Size > opt.MaxSize {
+		return nil
+	}
+	if opt.DetectBinary || opt.SkipBinary {
+		ok, err := detectBinary(f)
+		if err != nil {
+			return err
+		}
+		if ok && opt.SkipBinary {
+			return nil
+		}
+		f.Binary = ok
+	}
+	return fn(f)
+}
+
+func detectBinary(f FileEntry) (bool, error) {
+	r, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return binary.IsBinary(r)
+}
+
+func readEntries(walk func(fn func(FileEntry) error) error) (map[string][]byte, error) {
+	ret := map[string][]byte{}
+	err := walk(func(f FileEntry) error {
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", f.Path)
+		}
+		ret[f.Path] = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// underPaths reports whether p is one of paths or inside one of them. Empty paths match everything.
+func underPaths(p string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, dir := range paths {
+		dir = path.Clean(filepath.ToSlash(dir))
+		if dir == "." || p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathGlobs(p string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchPathGlob(strings.Split(pattern, "/"), strings.Split(p, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches path segments, letting "**" stand for zero or more segments.
+func matchPathGlob(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchPathGlob(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,267 @@
+package gtc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/pkg/errors"
+)
+
+func TestClient_ReadFilesWith(t *testing.T) {
+	c := mockInit()
+	c.CommitFiles(map[string][]byte{
+		".gitignore":          []byte("*.log\nbuild/\n"),
+		"conf/app.yaml":       {1},
+		"conf/deep/db.yaml":   {2},
+		"conf/deep/README.md": {3},
+		"vendor/lib.yaml":     {4},
+		"tracked.log":         {5},
+	}, "files")
+	for name, b := range map[string][]byte{
+		"debug.log":          {6},
+		"build/out.yaml":     {7},
+		"untracked.yaml":     {8},
+		"excluded/file.yaml": {9},
+	} {
+		c.addFile(name, b)
+	}
+	os.MkdirAll(filepath.Join(c.opt.DirPath, ".git", "info"), 0755)
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, ".git", "info", "exclude"), []byte("excluded/\n"), 0644)
+	tests := []struct {
+		name string
+		opt  ReadFilesOpt
+		want []string
+	}{
+		{
+			name: "include",
+			opt:  ReadFilesOpt{Include: []string{"**/*.yaml"}},
+			want: []string{"build/out.yaml", "conf/app.yaml", "conf/deep/db.yaml", "excluded/file.yaml", "untracked.yaml", "vendor/lib.yaml"},
+		},
+		{
+			name: "include_exclude",
+			opt:  ReadFilesOpt{Paths: []string{"conf", "vendor"}, Include: []string{"conf/**"}, Exclude: []string{"**/*.md"}},
+			want: []string{"conf/app.yaml", "conf/deep/db.yaml"},
+		},
+		{
+			name: "exclude_dir",
+			opt:  ReadFilesOpt{Include: []string{"**/*.yaml"}, Exclude: []string{"conf/deep", "build/**", "excluded"}},
+			want: []string{"conf/app.yaml", "untracked.yaml", "vendor/lib.yaml"},
+		},
+		{
+			name: "gitignore",
+			opt:  ReadFilesOpt{Gitignore: true, Exclude: []string{"conf/**", "vendor/**"}},
+			want: []string{".gitignore", "dir/dir_file", "file", "tracked.log", "untracked.yaml"},
+		},
+		{
+			name: "tracked_only",
+			opt:  ReadFilesOpt{TrackedOnly: true, Include: []string{"*"}},
+			want: []string{".gitignore", "file", "tracked.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ReadFilesWith(tt.opt)
+			if err != nil {
+				t.Fatalf("Client.ReadFilesWith() error = %v", err)
+			}
+			keys := []string{}
+			for k := range got {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("Client.ReadFilesWith() = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+	got, err := c.ReadFilesWith(ReadFilesOpt{Paths: []string{"conf/app.yaml"}, AbsolutePath: true})
+	want := map[string][]byte{filepath.Join(c.opt.DirPath, "conf/app.yaml"): {1}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Client.ReadFilesWith() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func Test_matchPathGlobs(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/*.yaml", "a.yaml", true},
+		{"**/*.yaml", "a/b/c.yaml", true},
+		{"*.yaml", "a/b.yaml", false},
+		{"a/**", "a", true},
+		{"a/**", "a/b/c", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/d/c", true},
+		{"a/**/c", "a/b/d", false},
+		{"a/*/c", "a/b/d/c", false},
+	}
+	for _, tt := range tests {
+		if got := matchPathGlobs(tt.path, []string{tt.pattern}); got != tt.want {
+			t.Errorf("matchPathGlobs(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestClient_ReadFilesAt(t *testing.T) {
+	c := mockWithRemote()
+	first := c.mustHash("HEAD")
+	c.CreateTag("v1", "HEAD", CreateTagOpt{})
+	c.CommitFiles(map[string][]byte{"file": {1}, "conf/app.yaml": {2}, "conf/README.md": {3}}, "update")
+	tests := []struct {
+		name    string
+		rev     string
+		opt     ReadFilesOpt
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{name: "head", rev: "", opt: ReadFilesOpt{Paths: []string{"file", "conf"}, Exclude: []string{"**/*.md"}}, want: map[string][]byte{"file": {1}, "conf/app.yaml": {2}}},
+		{name: "branch", rev: "master", opt: ReadFilesOpt{Include: []string{"conf/*.yaml"}}, want: map[string][]byte{"conf/app.yaml": {2}}},
+		{name: "tag", rev: "v1", want: map[string][]byte{"file": {0, 0}, "dir/dir_file": {0, 0}}},
+		{name: "hash", rev: first, opt: ReadFilesOpt{Paths: []string{"dir/"}}, want: map[string][]byte{"dir/dir_file": {0, 0}}},
+		{name: "remote", rev: "origin/master", opt: ReadFilesOpt{Paths: []string{"file", "none"}}, want: map[string][]byte{"file": {0, 0}}},
+		{name: "unknown", rev: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ReadFilesAt(tt.rev, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.ReadFilesAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.ReadFilesAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_WalkFiles(t *testing.T) {
+	c := mockInit()
+	c.CommitFiles(map[string][]byte{"text": []byte("hello"), "large": make([]byte, 100), "bin": {1, 0, 2}}, "files")
+	walks := map[string]func(WalkOpt, func(FileEntry) error) error{
+		"worktree": c.WalkFiles,
+		"revision": func(opt WalkOpt, fn func(FileEntry) error) error { return c.WalkFilesAt("HEAD", opt, fn) },
+	}
+	tests := []struct {
+		name string
+		opt  WalkOpt
+		want map[string]bool
+	}{
+		{name: "all", opt: WalkOpt{DetectBinary: true}, want: map[string]bool{"text": false, "large": true, "bin": true, "file": true, "dir/dir_file": true}},
+		{name: "max_size", opt: WalkOpt{MaxSize: 10}, want: map[string]bool{"text": false, "bin": false, "file": false, "dir/dir_file": false}},
+		{name: "skip_binary", opt: WalkOpt{SkipBinary: true, ReadFilesOpt: ReadFilesOpt{Paths: []string{"text", "bin"}}}, want: map[string]bool{"text": false}},
+	}
+	for walkName, walk := range walks {
+		for _, tt := range tests {
+			t.Run(walkName+"_"+tt.name, func(t *testing.T) {
+				got := map[string]bool{}
+				err := walk(tt.opt, func(f FileEntry) error {
+					got[f.Path] = f.Binary
+					if f.Path == "text" {
+						r, err := f.Open()
+						if err != nil {
+							return err
+						}
+						defer r.Close()
+						if b, _ := ioutil.ReadAll(r); string(b) != "hello" || f.Size != 5 || !f.Mode.IsRegular() {
+							t.Errorf("FileEntry = %v %v %v", string(b), f.Size, f.Mode)
+						}
+					}
+					return nil
+				})
+				if err != nil || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("walk = %v, %v, want %v", got, err, tt.want)
+				}
+			})
+		}
+		t.Run(walkName+"_stop", func(t *testing.T) {
+			n := 0
+			err := walk(WalkOpt{}, func(f FileEntry) error {
+				n++
+				return storer.ErrStop
+			})
+			if err != nil || n != 1 {
+				t.Errorf("walk stopped after %d files, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestClient_WalkFiles_oddTrees(t *testing.T) {
+	c := mockInit()
+	outside, _ := ioutil.TempDir("", "outside")
+	defer os.RemoveAll(outside)
+	ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)
+	os.Symlink("file", filepath.Join(c.opt.DirPath, "inside"))
+	os.Symlink("../file", filepath.Join(c.opt.DirPath, "dir", "up"))
+	os.Symlink("nowhere", filepath.Join(c.opt.DirPath, "dangling"))
+	os.MkdirAll(filepath.Join(c.opt.DirPath, "out"), 0755)
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(c.opt.DirPath, "out", "abs"))
+	os.Symlink("../../escape", filepath.Join(c.opt.DirPath, "out", "rel"))
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "dir", ".git"), []byte("gitdir: ../.git/modules/dir\n"), 0644)
+	os.Symlink("../.git", filepath.Join(c.opt.DirPath, "out", ".git"))
+
+	got, err := c.ReadFilesWith(ReadFilesOpt{Exclude: []string{"out"}})
+	want := map[string][]byte{
+		"file":         {0, 0},
+		"dir/dir_file": {0, 0},
+		"inside":       []byte("file"),
+		"dir/up":       []byte("../file"),
+		"dangling":     []byte("nowhere"),
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Client.ReadFilesWith() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := c.ReadFilesWith(ReadFilesOpt{Exclude: []string{"out"}, RefuseOutsideLinks: true}); err != nil {
+		t.Errorf("Client.ReadFilesWith() inside links error = %v", err)
+	}
+	links := map[string]string{}
+	c.WalkFiles(WalkOpt{ReadFilesOpt: ReadFilesOpt{Paths: []string{"out"}}}, func(f FileEntry) error {
+		if f.Mode&os.ModeSymlink == 0 {
+			t.Errorf("%s should be reported as a symlink", f.Path)
+		}
+		links[f.Path] = f.Link
+		return nil
+	})
+	if want := map[string]string{"out/abs": filepath.Join(outside, "secret"), "out/rel": "../../escape"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %v, want %v", links, want)
+	}
+
+	tests := []struct {
+		name  string
+		opt   ReadFilesOpt
+		op    string
+		cause error
+	}{
+		{name: "missing", opt: ReadFilesOpt{Paths: []string{"none"}}, op: "stat", cause: os.ErrNotExist},
+		{name: "outside_abs", opt: ReadFilesOpt{Paths: []string{"out/abs"}, RefuseOutsideLinks: true}, op: "readlink", cause: ErrLinkOutside},
+		{name: "outside_dangling", opt: ReadFilesOpt{Paths: []string{"out/rel"}, RefuseOutsideLinks: true}, op: "readlink", cause: ErrLinkOutside},
+	}
+	if os.Geteuid() != 0 {
+		locked := filepath.Join(c.opt.DirPath, "locked")
+		os.MkdirAll(locked, 0755)
+		ioutil.WriteFile(filepath.Join(locked, "f"), []byte{1}, 0000)
+		defer os.Chmod(filepath.Join(locked, "f"), 0644)
+		tests = append(tests, struct {
+			name  string
+			opt   ReadFilesOpt
+			op    string
+			cause error
+		}{name: "permission", opt: ReadFilesOpt{Paths: []string{"locked"}}, op: "open", cause: os.ErrPermission})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.ReadFilesWith(tt.opt)
+			var fe *FileError
+			if !errors.As(err, &fe) || fe.Op != tt.op || !errors.Is(err, tt.cause) {
+				t.Errorf("Client.ReadFilesWith() error = %v, want %s %v", err, tt.op, tt.cause)
+			}
+		})
+	}
+}
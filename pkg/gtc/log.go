@@ -0,0 +1,404 @@
+package gtc
+
+import (
+	"context"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/pkg/errors"
+)
+
+type LogOpt struct {
+	// Range is a single revision, "A..B" or the symmetric difference "A...B".
+	// Empty means HEAD, also on either side of a range.
+	Range string
+	// Paths limits the log to commits touching any of these files or directories.
+	Paths []string
+	// Author is a regular expression matched against "Name <email>".
+	Author string
+	Since  *time.Time
+	Until  *time.Time
+	// MaxCount limits the number of commits. 0 means unlimited.
+	MaxCount int
+	// FollowRenames continues the history of a single path beyond renames.
+	FollowRenames bool
+}
+
+type Signature struct {
+	Name  string    `json:"name" yaml:"name"`
+	Email string    `json:"email" yaml:"email"`
+	When  time.Time `json:"when" yaml:"when"`
+}
+
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+type Commit struct {
+	Hash      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+	Trailers  []Trailer
+}
+
+// CommitIter yields commits lazily. Next returns io.EOF when exhausted.
+type CommitIter struct {
+	iter   object.CommitIter
+	author *regexp.Regexp
+	opt    LogOpt
+	paths  []string
+	count  int
+}
+
+var trailerRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s*(.*)$`)
+
+// Log walks the history in committer time order like `git log`.
+func (c *Client) Log(opt LogOpt) (*CommitIter, error) {
+	if c.r == nil {
+		return nil, errors.New("this repository is not initialized")
+	}
+	if opt.FollowRenames && len(opt.Paths) != 1 {
+		return nil, errors.New("follow renames requires exactly one path")
+	}
+	it := &CommitIter{opt: opt}
+	if opt.Author != "" {
+		re, err := regexp.Compile(opt.Author)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid author pattern")
+		}
+		it.author = re
+	}
+	for _, p := range opt.Paths {
+		it.paths = append(it.paths, cleanPath(p))
+	}
+	tips, exclude, err := c.logRange(opt.Range)
+	if err != nil {
+		return nil, err
+	}
+	iters := []object.CommitIter{}
+	for _, tip := range tips {
+		iters = append(iters, object.NewCommitIterCTime(tip, exclude, nil))
+	}
+	it.iter = newUnionCommitIter(iters)
+	return it, nil
+}
+
+// logRange resolves a range to the tips to walk and the commits to leave out.
+// Like git, the boundary is found by walking both sides only down to their merge base.
+func (c *Client) logRange(rng string) ([]*object.Commit, map[plumbing.Hash]bool, error) {
+	sep := "..."
+	if !strings.Contains(rng, sep) {
+		sep = ".."
+	}
+	i := strings.Index(rng, sep)
+	if i < 0 {
+		head, err := c.resolveCommit(rng)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*object.Commit{head}, nil, nil
+	}
+	base, err := c.resolveCommit(rng[:i])
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := c.resolveCommit(rng[i+len(sep):])
+	if err != nil {
+		return nil, nil, err
+	}
+	_, sides, err := c.walkSides(base, head)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude := map[plumbing.Hash]bool{}
+	for h, f := range sides {
+		if f == bothSides || sep == ".." && f == aheadSide {
+			exclude[h] = true
+		}
+	}
+	if sep == ".." {
+		return []*object.Commit{head}, exclude, nil
+	}
+	return []*object.Commit{base, head}, exclude, nil
+}
+
+// unionCommitIter merges commit iterators in committer time order like a walk from all their tips.
+type unionCommitIter struct {
+	iters []object.CommitIter
+	next  []*object.Commit
+}
+
+func newUnionCommitIter(iters []object.CommitIter) object.CommitIter {
+	if len(iters) == 1 {
+		return iters[0]
+	}
+	return &unionCommitIter{iters: iters, next: make([]*object.Commit, len(iters))}
+}
+
+func (u *unionCommitIter) Next() (*object.Commit, error) {
+	best := -1
+	for i, iter := range u.iters {
+		if u.next[i] == nil && iter != nil {
+			commit, err := iter.Next()
+			if err == io.EOF {
+				iter.Close()
+				u.iters[i] = nil
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			u.next[i] = commit
+		}
+		if u.next[i] != nil && (best < 0 || u.next[i].Committer.When.After(u.next[best].Committer.When)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, io.EOF
+	}
+	commit := u.next[best]
+	u.next[best] = nil
+	return commit, nil
+}
+
+func (u *unionCommitIter) ForEach(fn func(*object.Commit) error) error {
+	defer u.Close()
+	for {
+		commit, err := u.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(commit); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (u *unionCommitIter) Close() {
+	for _, iter := range u.iters {
+		if iter != nil {
+			iter.Close()
+		}
+	}
+}
+
+func (it *CommitIter) Next() (Commit, error) {
+	for {
+		if it.opt.MaxCount > 0 && it.count >= it.opt.MaxCount {
+			return Commit{}, io.EOF
+		}
+		commit, err := it.iter.Next()
+		if err != nil {
+			return Commit{}, err
+		}
+		ok, err := it.match(commit)
+		if err != nil {
+			return Commit{}, err
+		}
+		if ok {
+			it.count++
+			return newCommit(commit), nil
+		}
+	}
+}
+
+func (it *CommitIter) ForEach(fn func(Commit) error) error {
+	defer it.Close()
+	for {
+		commit, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(commit); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (it *CommitIter) Close() {
+	it.iter.Close()
+}
+
+func (it *CommitIter) match(commit *object.Commit) (bool, error) {
+	if it.opt.Since != nil && commit.Committer.When.Before(*it.opt.Since) {
+		return false, nil
+	}
+	if it.opt.Until != nil && commit.Committer.When.After(*it.opt.Until) {
+		return false, nil
+	}
+	if it.author != nil && !it.author.MatchString(commit.Author.String()) {
+		return false, nil
+	}
+	if len(it.paths) == 0 {
+		return true, nil
+	}
+	for _, p := range it.paths {
+		touched, err := touchesPath(commit, p)
+		if err != nil {
+			return false, err
+		}
+		if !touched {
+			continue
+		}
+		if it.opt.FollowRenames {
+			if err := it.follow(commit); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// follow switches the followed path to its rename source when the commit renamed it.
+func (it *CommitIter) follow(commit *object.Commit) error {
+	if commit.NumParents() == 0 {
+		return nil
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return err
+	}
+	if _, err := treeEntryHash(parent, it.paths[0]); err == nil {
+		return nil
+	}
+	from, err := parent.Tree()
+	if err != nil {
+		return err
+	}
+	to, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	changes, err := object.DiffTreeWithOptions(context.Background(), from, to, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return err
+	}
+	for _, ch := range changes {
+		if ch.To.Name == it.paths[0] && ch.From.Name != "" {
+			it.paths[0] = ch.From.Name
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *Client) resolveCommit(rev string) (*object.Commit, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	h, err := c.r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve revision %s", rev)
+	}
+	return c.r.CommitObject(*h)
+}
+
+func ancestors(commit *object.Commit) (map[plumbing.Hash]bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	err := object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	return seen, err
+}
+
+// touchesPath reports whether the commit changed p compared to its parents.
+// Merge commits count only when p differs from every parent.
+func touchesPath(commit *object.Commit, p string) (bool, error) {
+	h, err := treeEntryHash(commit, p)
+	if err != nil && err != object.ErrEntryNotFound && err != object.ErrDirectoryNotFound {
+		return false, err
+	}
+	if commit.NumParents() == 0 {
+		return !h.IsZero(), nil
+	}
+	touched := true
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		ph, err := treeEntryHash(parent, p)
+		if err != nil && err != object.ErrEntryNotFound && err != object.ErrDirectoryNotFound {
+			return err
+		}
+		if ph == h {
+			touched = false
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return touched, err
+}
+
+func treeEntryHash(commit *object.Commit, p string) (plumbing.Hash, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if p == "" {
+		return tree.Hash, nil
+	}
+	entry, err := tree.FindEntry(p)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return entry.Hash, nil
+}
+
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+func newCommit(c *object.Commit) Commit {
+	parents := []string{}
+	for _, h := range c.ParentHashes {
+		parents = append(parents, h.String())
+	}
+	return Commit{
+		Hash:      c.Hash.String(),
+		Parents:   parents,
+		Author:    Signature{Name: c.Author.Name, Email: c.Author.Email, When: c.Author.When},
+		Committer: Signature{Name: c.Committer.Name, Email: c.Committer.Email, When: c.Committer.When},
+		Message:   c.Message,
+		Trailers:  parseTrailers(c.Message),
+	}
+}
+
+// parseTrailers reads "Key: value" lines from the last paragraph of a message.
+func parseTrailers(message string) []Trailer {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	trailers := []Trailer{}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') && len(trailers) > 0 {
+			trailers[len(trailers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		m := trailerRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+		trailers = append(trailers, Trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+	}
+	return trailers
+}
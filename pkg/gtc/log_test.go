@@ -0,0 +1,182 @@
+package gtc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Log(t *testing.T) {
+	c := mockWithHistory()
+	future := time.Now().AddDate(0, 0, 2)
+	tests := []struct {
+		name    string
+		opt     LogOpt
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ok_all",
+			opt:  LogOpt{},
+			want: []string{"update renamed", "rename a", "feat: add b", "add a", "init"},
+		},
+		{
+			name: "ok_range",
+			opt:  LogOpt{Range: "HEAD~2..HEAD"},
+			want: []string{"update renamed", "rename a"},
+		},
+		{
+			name: "ok_symmetric_difference",
+			opt:  LogOpt{Range: "HEAD...HEAD~2"},
+			want: []string{"update renamed", "rename a"},
+		},
+		{
+			name: "ok_range_to_head",
+			opt:  LogOpt{Range: "HEAD~1.."},
+			want: []string{"update renamed"},
+		},
+		{
+			name: "ok_max_count",
+			opt:  LogOpt{MaxCount: 1},
+			want: []string{"update renamed"},
+		},
+		{
+			name: "ok_path_dir",
+			opt:  LogOpt{Paths: []string{"dir"}},
+			want: []string{"feat: add b", "init"},
+		},
+		{
+			name: "ok_author",
+			opt:  LogOpt{Author: "^alice"},
+			want: []string{"feat: add b"},
+		},
+		{
+			name: "ok_since",
+			opt:  LogOpt{Since: &future},
+			want: []string{"update renamed", "rename a"},
+		},
+		{
+			name: "ok_path_without_follow",
+			opt:  LogOpt{Paths: []string{"renamed.txt"}},
+			want: []string{"update renamed", "rename a"},
+		},
+		{
+			name: "ok_follow_renames",
+			opt:  LogOpt{Paths: []string{"renamed.txt"}, FollowRenames: true},
+			want: []string{"update renamed", "rename a", "add a"},
+		},
+		{
+			name:    "ng_follow_multiple_paths",
+			opt:     LogOpt{Paths: []string{"a", "b"}, FollowRenames: true},
+			wantErr: true,
+		},
+		{
+			name:    "ng_revision",
+			opt:     LogOpt{Range: "no-rev"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iter, err := c.Log(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Log() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			got := []string{}
+			if err := iter.ForEach(func(commit Commit) error {
+				got = append(got, strings.Split(commit.Message, "\n")[0])
+				return nil
+			}); err != nil {
+				t.Errorf("CommitIter.ForEach() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Log() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Log_ranges(t *testing.T) {
+	c := mockWithHistory()
+	c.CreateBranch("topic", false)
+	c.gitExec([]string{"reset", "-q", "--hard", "HEAD~2"})
+	c.CommitFiles(map[string][]byte{"topic.txt": []byte("topic")}, "topic")
+	c.CommitFiles(map[string][]byte{"topic.txt": []byte("topic 2")}, "topic 2")
+	c.Checkout("master", false)
+	for _, rng := range []string{"master..topic", "topic..master", "master...topic", "topic...master", "topic~1...topic"} {
+		t.Run(rng, func(t *testing.T) {
+			want, err := c.gitExec([]string{"log", "--format=%s", rng})
+			if err != nil {
+				t.Fatalf("git log: %v", want)
+			}
+			got, err := c.logList(rng)
+			if err != nil {
+				t.Fatalf("Client.Log() error = %v", err)
+			}
+			subjects := []string{}
+			for _, commit := range got {
+				subjects = append(subjects, strings.Split(commit.Message, "\n")[0])
+			}
+			if !reflect.DeepEqual(subjects, want[:len(want)-1]) {
+				t.Errorf("Client.Log() = %v, want %v", subjects, want)
+			}
+		})
+	}
+
+	// the range boundary is found without reading history beyond the merge base
+	opt := mockOpt()
+	if out, err := c.gitExec([]string{"clone", "-q", "--depth=2", "file://" + c.opt.DirPath, opt.DirPath}); err != nil {
+		t.Fatalf("git clone: %v", out)
+	}
+	shallow, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := shallow.logList("HEAD~1..HEAD"); err != nil || len(got) != 1 || strings.TrimSpace(got[0].Message) != "update renamed" {
+		t.Errorf("Client.Log() on a shallow clone = %v, %v", got, err)
+	}
+}
+
+func Test_parseTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []Trailer
+	}{
+		{
+			name:    "ok",
+			message: "subject\n\nbody\n\nSigned-off-by: bob <bob@mail.com>\nRefs: #1\n",
+			want: []Trailer{
+				{Key: "Signed-off-by", Value: "bob <bob@mail.com>"},
+				{Key: "Refs", Value: "#1"},
+			},
+		},
+		{
+			name:    "ok_continuation",
+			message: "subject\n\nNote: first\n  second",
+			want:    []Trailer{{Key: "Note", Value: "first second"}},
+		},
+		{
+			name:    "no_trailer",
+			message: "subject\n\nthis is body",
+			want:    nil,
+		},
+		{
+			name:    "subject_only",
+			message: "Key: value",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTrailers(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTrailers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
 type Mock struct {
@@ -306,7 +308,7 @@ func mockWithTags(tagNames []string) Client {
 		os.WriteFile(fmt.Sprintf("%s/%s", c.opt.DirPath, name), []byte{0, 0, 0}, 0644)
 		c.Add(name)
 		c.commit(name, time.Now().AddDate(0, 0, i))
-		c.gitExec([]string{"tag", name})
+		c.CreateTag(name, "HEAD", CreateTagOpt{})
 	}
 	return c
 }
@@ -323,7 +325,7 @@ func mockWithRemoteTags(tagNames []string) Client {
 		os.WriteFile(fmt.Sprintf("%s/%s", rc.opt.DirPath, name), []byte{0, 0, 0}, 0644)
 		rc.Add(name)
 		rc.commit(name, time.Now().AddDate(0, 0, i))
-		rc.gitExec([]string{"tag", name})
+		rc.CreateTag(name, "HEAD", CreateTagOpt{})
 	}
 	return c
 }
@@ -379,3 +381,55 @@ func mockWithSubmodule() Client {
 	c2.AddClientAsSubmodule("test", c1)
 	return c2
 }
+
+func mockWithHistory() Client {
+	c := mockInit()
+	commits := []struct {
+		author  string
+		message string
+		files   map[string][]byte
+		move    []string
+	}{
+		{author: "bob", message: "add a", files: map[string][]byte{"a.txt": []byte("a\nb\nc\n")}},
+		{author: "alice", message: "feat: add b\n\nSigned-off-by: alice <alice@mail.com>\nRefs: #1", files: map[string][]byte{"dir/b.txt": []byte("b\n")}},
+		{author: "bob", message: "rename a", move: []string{"a.txt", "renamed.txt"}},
+		{author: "bob", message: "update renamed", files: map[string][]byte{"renamed.txt": []byte("a\nb\nc\nd\n")}},
+	}
+	for i, commit := range commits {
+		for name, blob := range commit.files {
+			c.addFile(name, blob)
+			c.Add(name)
+		}
+		if commit.move != nil {
+			c.gitExec(append([]string{"mv"}, commit.move...))
+		}
+		c.opt.AuthorName = commit.author
+		c.commit(commit.message, time.Now().AddDate(0, 0, i+1))
+	}
+	c.opt.AuthorName = "bob"
+	return c
+}
+
+func mockWithConflict() Client {
+	c := mockInit()
+	c.CreateBranch("other", false)
+	c.CommitFiles(map[string][]byte{"file": []byte("other")}, "other")
+	c.Checkout("master", false)
+	c.CommitFiles(map[string][]byte{"file": []byte("master")}, "master")
+	c.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "merge", "other"})
+	return c
+}
+
+func mockWithFetchedBehind() Client {
+	c := mockWithBehindFromRemote()
+	c.Fetch()
+	return c
+}
+
+func (c *Client) mustHash(rev string) string {
+	h, err := c.r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		panic(err)
+	}
+	return h.String()
+}
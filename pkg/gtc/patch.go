@@ -0,0 +1,931 @@
+package gtc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// PatchReport is the result of ApplyPatch. Nothing is written unless every file applies.
+type PatchReport struct {
+	Files []PatchFile `json:"files" yaml:"files"`
+}
+
+type PatchFile struct {
+	Path   string     `json:"path" yaml:"path"`
+	From   string     `json:"from,omitempty" yaml:"from,omitempty"`
+	Action DiffAction `json:"action" yaml:"action"`
+	// Conflict explains why the file could not be patched at all.
+	Conflict string `json:"conflict,omitempty" yaml:"conflict,omitempty"`
+	// Rejected are the headers of hunks whose context was not found.
+	Rejected []string `json:"rejected,omitempty" yaml:"rejected,omitempty"`
+}
+
+// MailboxReport is the result of ApplyMailbox. It stops at the first patch that does not apply.
+type MailboxReport struct {
+	// Commits are the hashes of the commits created, in order.
+	Commits []string `json:"commits" yaml:"commits"`
+	// Failed is the subject of the patch that stopped the run and Patch is its report.
+	Failed string      `json:"failed,omitempty" yaml:"failed,omitempty"`
+	Patch  PatchReport `json:"patch" yaml:"patch"`
+}
+
+type patchHunk struct {
+	header             string
+	oldStart, oldLines int
+	newStart, newLines int
+	// lines keep their ' ', '-' or '+' prefix and trailing newline.
+	lines []string
+}
+
+type patchSpec struct {
+	from, to         string
+	oldMode, newMode filemode.FileMode
+	added, deleted   bool
+	binary           bool
+	hunks            []*patchHunk
+	// oldHash and newHash are set by a full index line.
+	oldHash, newHash plumbing.Hash
+	// binaryHunk is the forward hunk of a GIT binary patch.
+	binaryHunk *binaryHunk
+}
+
+type binaryHunk struct {
+	delta bool
+	size  int
+	// lines are base85 encoded and deflated.
+	lines []string
+}
+
+// base85Alphabet is the encoding of git binary patches.
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+var (
+	hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	mboxFromRegexp   = regexp.MustCompile(`^From \S+ +(Mon|Tue|Wed|Thu|Fri|Sat|Sun) `)
+	patchFromRegexp  = regexp.MustCompile(`^From [0-9a-f]{40} Mon Sep 17 00:00:00 2001\n`)
+	subjectRegexp    = regexp.MustCompile(`^\s*(\[[^\]]*\]\s*)+`)
+)
+
+// FormatPatch formats the non-merge commits of rng as mbox messages like git format-patch,
+// oldest first. rng is "A..B" or a single revision meaning "A..HEAD". Binary changes are
+// written as GIT binary patches so the mbox applies without the original objects.
+func (c *Client) FormatPatch(rng string) ([]string, error) {
+	if !strings.Contains(rng, "..") {
+		rng += "..HEAD"
+	}
+	it, err := c.Log(LogOpt{Range: rng})
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	if err := it.ForEach(func(commit Commit) error {
+		if len(commit.Parents) < 2 {
+			commits = append([]Commit{commit}, commits...)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for i, commit := range commits {
+		from := diffEmptyTree
+		if len(commit.Parents) > 0 {
+			from = commit.Parents[0]
+		}
+		diffs, err := c.Diff(from, commit.Hash, DiffOpt{})
+		if err != nil {
+			return nil, err
+		}
+		stats := make([]string, len(diffs))
+		for j, d := range diffs {
+			stats[j] = strconv.Itoa(d.Additions + d.Deletions)
+			if !d.Binary {
+				continue
+			}
+			src, dst, err := c.diffBlobs(d)
+			if err != nil {
+				return nil, err
+			}
+			stats[j] = fmt.Sprintf("Bin %d -> %d bytes", len(src), len(dst))
+			diffs[j].Patch = binaryPatch(d.Patch, src, dst)
+		}
+		ret = append(ret, formatPatch(commit, diffs, stats, i+1, len(commits)))
+	}
+	return ret, nil
+}
+
+// diffBlobs reads both sides of d. A missing side is empty.
+func (c *Client) diffBlobs(d FileDiff) ([]byte, []byte, error) {
+	ret := [][]byte{nil, nil}
+	for i, h := range []string{d.FromHash, d.ToHash} {
+		if h == "" || plumbing.NewHash(h).IsZero() {
+			continue
+		}
+		b, err := c.blobEntry("", plumbing.NewHash(h), filemode.Regular).read()
+		if err != nil {
+			return nil, nil, err
+		}
+		ret[i] = b
+	}
+	return ret[0], ret[1], nil
+}
+
+// binaryPatch replaces the "Binary files differ" line of patch with literal hunks of dst
+// and src, like git diff --binary.
+func binaryPatch(patch string, src, dst []byte) string {
+	var sb strings.Builder
+	for _, l := range splitLines(patch) {
+		if !strings.HasPrefix(l, "Binary files ") {
+			sb.WriteString(l)
+			continue
+		}
+		sb.WriteString("GIT binary patch\n")
+		writeBinaryHunk(&sb, dst)
+		writeBinaryHunk(&sb, src)
+	}
+	return sb.String()
+}
+
+func writeBinaryHunk(sb *strings.Builder, data []byte) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	fmt.Fprintf(sb, "literal %d\n", len(data))
+	z := buf.Bytes()
+	for len(z) > 0 {
+		n := len(z)
+		if n > 52 {
+			n = 52
+		}
+		// the first character is the number of bytes in the line
+		if n <= 26 {
+			sb.WriteByte(byte('A' + n - 1))
+		} else {
+			sb.WriteByte(byte('a' + n - 27))
+		}
+		for i := 0; i < n; i += 4 {
+			var v uint32
+			for j := 0; j < 4; j++ {
+				v <<= 8
+				if i+j < n {
+					v |= uint32(z[i+j])
+				}
+			}
+			var enc [5]byte
+			for j := 4; j >= 0; j-- {
+				enc[j] = base85Alphabet[v%85]
+				v /= 85
+			}
+			sb.Write(enc[:])
+		}
+		sb.WriteByte('\n')
+		z = z[n:]
+	}
+	sb.WriteByte('\n')
+}
+
+func formatPatch(commit Commit, diffs []FileDiff, stats []string, n, total int) string {
+	paragraphs := strings.SplitN(strings.TrimSpace(commit.Message), "\n\n", 2)
+	subject := strings.Join(strings.Fields(paragraphs[0]), " ")
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", n, total)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From %s Mon Sep 17 00:00:00 2001\n", commit.Hash)
+	fmt.Fprintf(&sb, "From: %s\n", (&mail.Address{Name: commit.Author.Name, Address: commit.Author.Email}).String())
+	fmt.Fprintf(&sb, "Date: %s\n", commit.Author.When.Format(time.RFC1123Z))
+	fmt.Fprintf(&sb, "Subject: %s\n\n", mime.QEncoding.Encode("utf-8", prefix+" "+subject))
+	if len(paragraphs) == 2 {
+		sb.WriteString(strings.TrimSpace(paragraphs[1]) + "\n")
+	}
+	sb.WriteString("---\n")
+	additions, deletions := 0, 0
+	for i, d := range diffs {
+		fmt.Fprintf(&sb, " %s | %s\n", d.path(), stats[i])
+		additions, deletions = additions+d.Additions, deletions+d.Deletions
+	}
+	sb.WriteString(diffstatSummary(len(diffs), additions, deletions) + "\n\n")
+	for _, d := range diffs {
+		sb.WriteString(d.Patch)
+	}
+	sb.WriteString("-- \ngtc\n\n")
+	return sb.String()
+}
+
+// diffstatSummary formats the last line of git diff --stat.
+func diffstatSummary(files, additions, deletions int) string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf(one, n)
+		}
+		return fmt.Sprintf(many, n)
+	}
+	ret := plural(files, " %d file changed", " %d files changed")
+	// like git, zero counts are only shown when both are zero
+	if additions > 0 || deletions == 0 {
+		ret += plural(additions, ", %d insertion(+)", ", %d insertions(+)")
+	}
+	if deletions > 0 || additions == 0 {
+		ret += plural(deletions, ", %d deletion(-)", ", %d deletions(-)")
+	}
+	return ret
+}
+
+// ApplyMailbox applies the patches of an mbox and commits each of them with the author
+// and date of its mail. The worktree must be clean.
+func (c *Client) ApplyMailbox(r io.Reader) (MailboxReport, error) {
+	ret := MailboxReport{Commits: []string{}}
+	clean, err := c.IsCleanWith(CleanOpt{IgnoreUntracked: true})
+	if err != nil {
+		return ret, err
+	}
+	if !clean {
+		return ret, errors.New("worktree is not clean")
+	}
+	messages, err := splitMailbox(r)
+	if err != nil {
+		return ret, err
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return ret, err
+	}
+	for _, m := range messages {
+		author, message, diff, err := parsePatchMail(m)
+		if err != nil {
+			return ret, err
+		}
+		report, err := c.ApplyPatch(diff, true)
+		if err != nil {
+			return ret, err
+		}
+		if report.Err() != nil {
+			ret.Failed, ret.Patch = strings.SplitN(message, "\n", 2)[0], report
+			return ret, nil
+		}
+		h, err := w.Commit(message, &git.CommitOptions{
+			Author: author,
+			Committer: &object.Signature{
+				Name:  c.opt.AuthorName,
+				Email: c.opt.AuthorEmail,
+				When:  time.Now(),
+			},
+		})
+		if err != nil {
+			return ret, err
+		}
+		ret.Commits = append(ret.Commits, h.String())
+	}
+	return ret, nil
+}
+
+func (r MailboxReport) Err() error {
+	if r.Failed == "" {
+		return nil
+	}
+	return errors.Wrapf(r.Patch.Err(), "failed to apply %q after %d commits", r.Failed, len(r.Commits))
+}
+
+// ApplyPatch applies a git or plain unified diff to the worktree like git apply.
+// toIndex stages the result like --index. Conflicts and rejected hunks are in the report
+// and leave the worktree untouched.
+func (c *Client) ApplyPatch(diff string, toIndex bool) (PatchReport, error) {
+	ret := PatchReport{Files: []PatchFile{}}
+	specs, err := parsePatch(diff)
+	if err != nil {
+		return ret, err
+	}
+	if len(specs) == 0 {
+		return ret, errors.New("no patch found")
+	}
+	var entries map[string]plumbing.Hash
+	if toIndex {
+		idx, err := c.r.Storer.Index()
+		if err != nil {
+			return ret, err
+		}
+		entries = map[string]plumbing.Hash{}
+		for _, e := range idx.Entries {
+			entries[e.Name] = e.Hash
+		}
+	}
+	// symbolic links created by the patch count when checking the paths of other files
+	links := map[string]bool{}
+	for _, s := range specs {
+		if s.newMode == filemode.Symlink && !s.deleted {
+			links[s.to] = true
+		}
+	}
+	results := make([][]byte, len(specs))
+	failed := false
+	for i, s := range specs {
+		f := PatchFile{Path: s.to, Action: DiffModified}
+		switch {
+		case s.added:
+			f.Action = DiffAdded
+		case s.deleted:
+			f.Path, f.Action = s.from, DiffDeleted
+		case s.from != s.to:
+			f.From, f.Action = s.from, DiffRenamed
+		}
+		results[i], f.Conflict, f.Rejected, err = c.patchFile(s, entries, links)
+		if err != nil {
+			return ret, err
+		}
+		failed = failed || f.Conflict != "" || len(f.Rejected) > 0
+		ret.Files = append(ret.Files, f)
+	}
+	if failed {
+		return ret, nil
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return ret, err
+	}
+	for i, s := range specs {
+		if err := c.writePatchedFile(w, s, results[i], toIndex); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+func (r PatchReport) Err() error {
+	msgs := []string{}
+	for _, f := range r.Files {
+		if f.Conflict != "" {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", f.Path, f.Conflict))
+		}
+		if len(f.Rejected) > 0 {
+			msgs = append(msgs, fmt.Sprintf("%s: %d hunks rejected", f.Path, len(f.Rejected)))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.Errorf("patch does not apply: %s", strings.Join(msgs, ", "))
+}
+
+// patchFile returns the patched content of s, or the conflict and rejected hunks.
+func (c *Client) patchFile(s *patchSpec, index map[string]plumbing.Hash, links map[string]bool) ([]byte, string, []string, error) {
+	for _, p := range []string{s.from, s.to} {
+		if conflict := c.patchPathConflict(p, links); conflict != "" {
+			return nil, conflict, nil, nil
+		}
+	}
+	if s.binary && s.binaryHunk == nil {
+		return nil, "binary patch without data", nil, nil
+	}
+	var base []byte
+	if s.added {
+		if _, err := os.Lstat(filepath.Join(c.opt.DirPath, s.to)); err == nil {
+			return nil, "already exists in working directory", nil, nil
+		}
+		if _, ok := index[s.to]; ok {
+			return nil, "already exists in index", nil, nil
+		}
+	} else {
+		p := filepath.Join(c.opt.DirPath, s.from)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil, "does not exist in working directory", nil, nil
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			base = []byte(target)
+		} else if base, err = ioutil.ReadFile(p); err != nil {
+			return nil, "", nil, err
+		}
+		if index != nil {
+			if h, ok := index[s.from]; !ok || h != plumbing.ComputeHash(plumbing.BlobObject, base) {
+				return nil, "does not match index", nil, nil
+			}
+		}
+	}
+	if s.from != s.to && !s.added && !s.deleted {
+		if _, err := os.Lstat(filepath.Join(c.opt.DirPath, s.to)); err == nil {
+			return nil, "already exists in working directory", nil, nil
+		}
+	}
+	if s.binaryHunk != nil {
+		out, conflict := applyBinaryHunk(s, base)
+		return out, conflict, nil, nil
+	}
+	out, rejected := applyHunks(base, s.hunks)
+	if len(rejected) == 0 && s.deleted && len(out) > 0 {
+		return nil, "deleted file still has contents", nil, nil
+	}
+	return out, "", rejected, nil
+}
+
+// patchPathConflict returns why git apply would refuse p: it must be a relative path
+// inside the worktree, out of .git and not beyond a symbolic link.
+func (c *Client) patchPathConflict(p string, links map[string]bool) string {
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") {
+		return "absolute path"
+	}
+	if !isRelativePath(p) {
+		return "invalid path"
+	}
+	parts := strings.Split(p, "/")
+	for i := range parts[:len(parts)-1] {
+		dir := strings.Join(parts[:i+1], "/")
+		if links[dir] {
+			return "beyond a symbolic link"
+		}
+		if fi, err := os.Lstat(filepath.Join(c.opt.DirPath, dir)); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "beyond a symbolic link"
+		}
+	}
+	return ""
+}
+
+func (c *Client) writePatchedFile(w *git.Worktree, s *patchSpec, content []byte, toIndex bool) error {
+	if s.deleted || s.from != s.to {
+		if toIndex {
+			if _, err := w.Remove(s.from); err != nil {
+				return err
+			}
+		} else if err := os.Remove(filepath.Join(c.opt.DirPath, s.from)); err != nil {
+			return err
+		}
+	}
+	if s.deleted {
+		return nil
+	}
+	p := filepath.Join(c.opt.DirPath, s.to)
+	mode := s.newMode
+	if mode == filemode.Empty {
+		mode = s.oldMode
+	}
+	if mode == filemode.Empty && !s.added && s.from == s.to {
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&0111 != 0 {
+			mode = filemode.Executable
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch mode {
+	case filemode.Symlink:
+		if err := os.Symlink(string(content), p); err != nil {
+			return err
+		}
+	case filemode.Executable:
+		if err := ioutil.WriteFile(p, content, 0755); err != nil {
+			return err
+		}
+	default:
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			return err
+		}
+	}
+	if toIndex {
+		_, err := w.Add(s.to)
+		return err
+	}
+	return nil
+}
+
+// applyBinaryHunk checks base against the full index line and applies the literal or delta
+// hunk of a GIT binary patch.
+func applyBinaryHunk(s *patchSpec, base []byte) ([]byte, string) {
+	if !s.added && !s.oldHash.IsZero() && plumbing.ComputeHash(plumbing.BlobObject, base) != s.oldHash {
+		return nil, "does not match the binary patch"
+	}
+	data, err := decodeBinaryHunk(s.binaryHunk)
+	if err != nil {
+		return nil, err.Error()
+	}
+	out := data
+	if s.binaryHunk.delta {
+		if out, err = packfile.PatchDelta(base, data); err != nil {
+			return nil, "corrupt binary patch"
+		}
+	}
+	if s.deleted && len(out) > 0 {
+		return nil, "deleted file still has contents"
+	}
+	if !s.deleted && !s.newHash.IsZero() && plumbing.ComputeHash(plumbing.BlobObject, out) != s.newHash {
+		return nil, "binary patch creates incorrect result"
+	}
+	return out, ""
+}
+
+// decodeBinaryHunk decodes the base85 lines of h and inflates them.
+func decodeBinaryHunk(h *binaryHunk) ([]byte, error) {
+	corrupt := errors.New("corrupt binary patch")
+	var z []byte
+	for _, l := range h.lines {
+		if len(l) < 6 || (len(l)-1)%5 != 0 {
+			return nil, corrupt
+		}
+		n := 0
+		switch c := l[0]; {
+		case 'A' <= c && c <= 'Z':
+			n = int(c-'A') + 1
+		case 'a' <= c && c <= 'z':
+			n = int(c-'a') + 27
+		default:
+			return nil, corrupt
+		}
+		chunk := []byte{}
+		for i := 1; i < len(l); i += 5 {
+			var v uint32
+			for j := 0; j < 5; j++ {
+				d := strings.IndexByte(base85Alphabet, l[i+j])
+				if d < 0 {
+					return nil, corrupt
+				}
+				v = v*85 + uint32(d)
+			}
+			chunk = append(chunk, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+		if n > len(chunk) {
+			return nil, corrupt
+		}
+		z = append(z, chunk[:n]...)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(z))
+	if err != nil {
+		return nil, corrupt
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	if err != nil || len(data) != h.size {
+		return nil, corrupt
+	}
+	return data, nil
+}
+
+// applyHunks applies hunks in order. A hunk whose old lines are not at the stated line
+// is searched for nearby, as git apply does without fuzz.
+func applyHunks(base []byte, hunks []*patchHunk) ([]byte, []string) {
+	lines := splitLines(string(base))
+	out := []string{}
+	var rejected []string
+	cursor, offset := 0, 0
+	for _, h := range hunks {
+		old, repl := []string{}, []string{}
+		for _, l := range h.lines {
+			switch l[0] {
+			case ' ':
+				old, repl = append(old, l[1:]), append(repl, l[1:])
+			case '-':
+				old = append(old, l[1:])
+			case '+':
+				repl = append(repl, l[1:])
+			}
+		}
+		// A hunk without old lines inserts after line oldStart.
+		start := h.oldStart - 1
+		if h.oldLines == 0 {
+			start++
+		}
+		pos := findLines(lines, old, start+offset, cursor)
+		if pos < 0 {
+			rejected = append(rejected, h.header)
+			continue
+		}
+		out = append(append(out, lines[cursor:pos]...), repl...)
+		offset = pos - start
+		cursor = pos + len(old)
+	}
+	out = append(out, lines[cursor:]...)
+	return []byte(strings.Join(out, "")), rejected
+}
+
+// findLines returns the position of old in lines closest to want, not before min.
+func findLines(lines, old []string, want, min int) int {
+	match := func(pos int) bool {
+		if pos < min || pos+len(old) > len(lines) {
+			return false
+		}
+		for i, l := range old {
+			if lines[pos+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; want-d >= min || want+d <= len(lines); d++ {
+		if match(want - d) {
+			return want - d
+		}
+		if match(want + d) {
+			return want + d
+		}
+	}
+	return -1
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// parsePatch reads the file patches of a git diff or a plain unified diff.
+func parsePatch(diff string) ([]*patchSpec, error) {
+	ret := []*patchSpec{}
+	var cur *patchSpec
+	var hunk *patchHunk
+	oldLeft, newLeft := 0, 0
+	// binaryState is 1 before the forward hunk of a GIT binary patch, 2 in it,
+	// 3 after it and 4 in the optional reverse hunk.
+	binaryState := 0
+	for _, line := range splitLines(diff) {
+		text := strings.TrimRight(line, "\r\n")
+		if binaryState > 0 {
+			isHeader := strings.HasPrefix(text, "literal ") || strings.HasPrefix(text, "delta ")
+			switch {
+			case binaryState == 1 && isHeader:
+				fields := strings.Fields(text)
+				size, err := strconv.Atoi(fields[len(fields)-1])
+				if err != nil || len(fields) != 2 {
+					return nil, errors.Errorf("corrupt binary patch at line %q", text)
+				}
+				cur.binaryHunk, binaryState = &binaryHunk{delta: fields[0] == "delta", size: size}, 2
+				continue
+			case binaryState == 1:
+				return nil, errors.Errorf("corrupt binary patch at line %q", text)
+			case binaryState == 2 && text != "":
+				cur.binaryHunk.lines = append(cur.binaryHunk.lines, text)
+				continue
+			case binaryState == 2:
+				binaryState = 3
+				continue
+			case binaryState == 3 && isHeader:
+				binaryState = 4
+				continue
+			case binaryState == 4:
+				if text == "" {
+					binaryState = 0
+				}
+				continue
+			}
+			binaryState = 0
+		}
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			if text == "" {
+				line, text = " \n", " "
+			}
+			switch text[0] {
+			case ' ':
+				oldLeft, newLeft = oldLeft-1, newLeft-1
+			case '-':
+				oldLeft--
+			case '+':
+				newLeft--
+			case '\\':
+				noNewline(hunk)
+				continue
+			default:
+				return nil, errors.Errorf("corrupt patch at line %q", text)
+			}
+			hunk.lines = append(hunk.lines, line)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, `\`) && hunk != nil:
+			noNewline(hunk)
+		case strings.HasPrefix(text, "diff --git "):
+			cur, hunk = &patchSpec{}, nil
+			ret = append(ret, cur)
+			cur.from, cur.to = parseGitDiffHeader(strings.TrimPrefix(text, "diff --git "))
+		case strings.HasPrefix(text, "--- ") && (cur == nil || len(cur.hunks) > 0):
+			cur, hunk = &patchSpec{}, nil
+			ret = append(ret, cur)
+			fallthrough
+		case strings.HasPrefix(text, "--- ") && cur != nil:
+			p := patchPath(strings.TrimPrefix(text, "--- "))
+			if p == "" {
+				cur.added = true
+			} else {
+				cur.from = p
+			}
+		case strings.HasPrefix(text, "+++ ") && cur != nil:
+			p := patchPath(strings.TrimPrefix(text, "+++ "))
+			if p == "" {
+				cur.deleted = true
+			} else {
+				cur.to = p
+			}
+		case strings.HasPrefix(text, "@@ ") && cur != nil:
+			m := hunkHeaderRegexp.FindStringSubmatch(text)
+			if m == nil {
+				return nil, errors.Errorf("invalid hunk header %q", text)
+			}
+			hunk = &patchHunk{header: text, oldLines: 1, newLines: 1}
+			hunk.oldStart, _ = strconv.Atoi(m[1])
+			hunk.newStart, _ = strconv.Atoi(m[3])
+			if m[2] != "" {
+				hunk.oldLines, _ = strconv.Atoi(m[2])
+			}
+			if m[4] != "" {
+				hunk.newLines, _ = strconv.Atoi(m[4])
+			}
+			oldLeft, newLeft = hunk.oldLines, hunk.newLines
+			cur.hunks = append(cur.hunks, hunk)
+		case text == "GIT binary patch" && cur != nil:
+			cur.binary, binaryState = true, 1
+		case cur != nil && len(cur.hunks) == 0:
+			if err := parseExtendedHeader(cur, text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, s := range ret {
+		if s.added {
+			s.from = s.to
+		}
+		if s.deleted {
+			s.to = s.from
+		}
+		if s.from == "" || s.to == "" {
+			return nil, errors.New("patch without file names")
+		}
+	}
+	return ret, nil
+}
+
+func parseExtendedHeader(s *patchSpec, text string) error {
+	mode := func(v string) (filemode.FileMode, error) {
+		return filemode.New(strings.TrimSpace(v))
+	}
+	var err error
+	switch {
+	case strings.HasPrefix(text, "old mode "):
+		s.oldMode, err = mode(strings.TrimPrefix(text, "old mode "))
+	case strings.HasPrefix(text, "new mode "):
+		s.newMode, err = mode(strings.TrimPrefix(text, "new mode "))
+	case strings.HasPrefix(text, "new file mode "):
+		s.added = true
+		s.newMode, err = mode(strings.TrimPrefix(text, "new file mode "))
+	case strings.HasPrefix(text, "deleted file mode "):
+		s.deleted = true
+		s.oldMode, err = mode(strings.TrimPrefix(text, "deleted file mode "))
+	case strings.HasPrefix(text, "rename from "):
+		s.from = strings.TrimPrefix(text, "rename from ")
+	case strings.HasPrefix(text, "rename to "):
+		s.to = strings.TrimPrefix(text, "rename to ")
+	case strings.HasPrefix(text, "index "):
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			break
+		}
+		if hashes := strings.Split(fields[1], ".."); len(hashes) == 2 && plumbing.IsHash(hashes[0]) && plumbing.IsHash(hashes[1]) {
+			s.oldHash, s.newHash = plumbing.NewHash(hashes[0]), plumbing.NewHash(hashes[1])
+		}
+		if len(fields) == 3 {
+			s.oldMode, err = mode(fields[2])
+		}
+	case strings.HasPrefix(text, "Binary files "):
+		s.binary = true
+	}
+	return err
+}
+
+// parseGitDiffHeader splits "a/<from> b/<to>".
+func parseGitDiffHeader(s string) (string, string) {
+	if i := strings.Index(s, " b/"); strings.HasPrefix(s, "a/") && i > 0 {
+		return s[2:i], s[i+3:]
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return "", ""
+	}
+	return patchPath(fields[0]), patchPath(fields[1])
+}
+
+// patchPath strips the a/ or b/ prefix and a trailing timestamp. /dev/null becomes empty.
+func patchPath(s string) string {
+	if i := strings.Index(s, "\t"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+// noNewline drops the newline of the last line of hunk.
+func noNewline(hunk *patchHunk) {
+	if n := len(hunk.lines); n > 0 {
+		hunk.lines[n-1] = strings.TrimSuffix(hunk.lines[n-1], "\n")
+	}
+}
+
+// splitMailbox splits an mbox at its "From " lines.
+func splitMailbox(r io.Reader) ([]string, error) {
+	ret := []string{}
+	var cur *strings.Builder
+	// format-patch leaves "From " lines of messages as they are, so its mails are split only
+	// at its own separator
+	separator := mboxFromRegexp
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if cur == nil && patchFromRegexp.MatchString(line) {
+				separator = patchFromRegexp
+			}
+			if separator.MatchString(line) {
+				cur = &strings.Builder{}
+				ret = append(ret, "")
+			} else if cur != nil {
+				cur.WriteString(line)
+			}
+			if cur != nil {
+				ret[len(ret)-1] = cur.String()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no patches found in mailbox")
+	}
+	return ret, nil
+}
+
+// parsePatchMail returns the author, commit message and diff of a format-patch mail.
+func parsePatchMail(m string) (*object.Signature, string, string, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(m))
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to parse patch mail")
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to parse patch author")
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to parse patch date")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to parse patch subject")
+	}
+	subject = subjectRegexp.ReplaceAllString(subject, "")
+	b, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	body, diff := "", ""
+	lines := splitLines(string(b))
+	for i, l := range lines {
+		if l == "---\n" || strings.HasPrefix(l, "diff ") || strings.HasPrefix(l, "--- ") {
+			body = strings.Join(lines[:i], "")
+			diff = strings.Join(lines[i:], "")
+			break
+		}
+	}
+	message := strings.TrimSpace(subject) + "\n"
+	if body = strings.TrimSpace(body); body != "" {
+		message += "\n" + body + "\n"
+	}
+	return &object.Signature{Name: from.Name, Email: from.Address, When: date}, message, diff, nil
+}
@@ -0,0 +1,300 @@
+package gtc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mockForPatch() (Client, string) {
+	c := mockInit()
+	base := c.mustHash("HEAD")
+	// bin is large enough for git to write its change as a binary delta
+	bin := make([]byte, 4096)
+	for i := range bin {
+		bin[i] = byte(i * 7 % 251)
+	}
+	c.CommitFiles(map[string][]byte{"text": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")}, "add text\n\nwith a body\nof two lines")
+	c.CommitFiles(map[string][]byte{"text": []byte("1\ntwo\n3\n4\n5\n6\n7\n8\nnine\n10\n"), "new/file": []byte("no newline"), "bin": bin}, "update text")
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	copy(bin[100:], []byte{0, 0, 0, 0})
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "bin"), bin, 0644)
+	c.gitExec([]string{"rm", "-q", "new/file"})
+	c.gitExec([]string{"add", "run.sh", "bin"})
+	c.gitExec([]string{"-c", "user.name=alice", "-c", "user.email=alice@mail.com", "commit", "-q", "-m", "remove file"})
+	return c, base
+}
+
+func gitRevParse(t *testing.T, c Client, rev string) string {
+	out, err := c.gitExec([]string{"rev-parse", rev})
+	if err != nil {
+		t.Fatalf("git rev-parse %s: %v", rev, out)
+	}
+	return out[0]
+}
+
+func gitLogAuthors(t *testing.T, c Client, rng string) []string {
+	out, err := c.gitExec([]string{"log", "--format=%an <%ae> %ad %s", rng})
+	if err != nil {
+		t.Fatalf("git log: %v", out)
+	}
+	return out
+}
+
+func TestClient_FormatPatch(t *testing.T) {
+	c, base := mockForPatch()
+	patches, err := c.FormatPatch(base)
+	if err != nil {
+		t.Fatalf("Client.FormatPatch() error = %v", err)
+	}
+	if len(patches) != 3 || !strings.Contains(patches[0], "Subject: [PATCH 1/3] add text\n\nwith a body\nof two lines\n---\n") {
+		t.Fatalf("Client.FormatPatch() = %v", patches)
+	}
+	mbox := filepath.Join(c.opt.DirPath, ".git", "patches.mbox")
+	ioutil.WriteFile(mbox, []byte(strings.Join(patches, "")), 0644)
+	c.gitExec([]string{"checkout", "-q", "-b", "am", base})
+	if out, err := c.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "am", "-q", mbox}); err != nil {
+		t.Fatalf("git am: %v", out)
+	}
+	if got, want := gitRevParse(t, c, "am^{tree}"), gitRevParse(t, c, "master^{tree}"); got != want {
+		t.Errorf("tree after git am = %v, want %v", got, want)
+	}
+	if got, want := gitLogAuthors(t, c, base+"..am"), gitLogAuthors(t, c, base+"..master"); !reflect.DeepEqual(got, want) {
+		t.Errorf("authors after git am = %v, want %v", got, want)
+	}
+	if patches, err := c.FormatPatch("master~1..master"); err != nil || len(patches) != 1 || !strings.Contains(patches[0], "Subject: [PATCH] remove file\n") {
+		t.Errorf("Client.FormatPatch() = %v, %v", patches, err)
+	}
+	for i, rev := range []string{"master~2", "master~1", "master"} {
+		out, err := c.gitExec([]string{"format-patch", "--stdout", "-1", rev})
+		if err != nil {
+			t.Fatalf("git format-patch: %v", out)
+		}
+		for _, l := range out {
+			if strings.Contains(l, " changed") && !strings.Contains(patches[i], "\n"+l+"\n") {
+				t.Errorf("Client.FormatPatch() of %s should have %q:\n%s", rev, l, patches[i])
+			}
+		}
+	}
+	if !strings.Contains(patches[1], " bin | Bin 0 -> 4096 bytes\n") || !strings.Contains(patches[2], "GIT binary patch\n") {
+		t.Errorf("Client.FormatPatch() should have binary patches: %v", patches)
+	}
+}
+
+func TestClient_ApplyMailbox(t *testing.T) {
+	tests := []struct {
+		name string
+		// mbox returns the mailbox of base..master.
+		mbox func(t *testing.T, c Client, base string) string
+	}{
+		{name: "git_format_patch", mbox: func(t *testing.T, c Client, base string) string {
+			out, err := c.gitExec([]string{"format-patch", "-q", "--stdout", base + "..master"})
+			if err != nil {
+				t.Fatalf("git format-patch: %v", out)
+			}
+			return strings.Join(out, "\n")
+		}},
+		{name: "format_patch", mbox: func(t *testing.T, c Client, base string) string {
+			patches, err := c.FormatPatch(base + "..master")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.Join(patches, "")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, base := mockForPatch()
+			mbox := tt.mbox(t, c, base)
+			c.gitExec([]string{"checkout", "-q", "-b", "am", base})
+			report, err := c.ApplyMailbox(strings.NewReader(mbox))
+			if err != nil || report.Err() != nil || len(report.Commits) != 3 {
+				t.Fatalf("Client.ApplyMailbox() = %v, %v, %v", report, err, report.Err())
+			}
+			if got, want := gitRevParse(t, c, "am^{tree}"), gitRevParse(t, c, "master^{tree}"); got != want {
+				t.Errorf("tree after Client.ApplyMailbox() = %v, want %v", got, want)
+			}
+			if got, want := gitLogAuthors(t, c, base+"..am"), gitLogAuthors(t, c, base+"..master"); !reflect.DeepEqual(got, want) {
+				t.Errorf("authors after Client.ApplyMailbox() = %v, want %v", got, want)
+			}
+			if out, _ := c.gitExec([]string{"log", "-1", "--format=%B", "am~2"}); !reflect.DeepEqual(out[:3], []string{"add text", "", "with a body"}) {
+				t.Errorf("message after Client.ApplyMailbox() = %v", out)
+			}
+			assertion(t, c, map[string][]string{"status": {""}})
+
+			report, err = c.ApplyMailbox(strings.NewReader(mbox))
+			if err != nil || report.Err() == nil || report.Failed != "add text" || len(report.Commits) != 0 {
+				t.Errorf("Client.ApplyMailbox() again = %v, %v", report, err)
+			}
+			assertion(t, c, map[string][]string{"status": {""}})
+		})
+	}
+}
+
+func TestClient_ApplyPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		diff      string
+		toIndex   bool
+		want      map[string]string
+		status    []string
+		wantFiles []PatchFile
+	}{
+		{
+			name: "plain_offset",
+			diff: "--- a/text\n+++ b/text\n@@ -1,3 +1,3 @@\n 3\n-4\n+four\n 5\n@@ -8,2 +8,3 @@\n 9\n 10\n+11\n",
+			want: map[string]string{"text": "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n"},
+			status: []string{
+				" M text", "",
+			},
+			wantFiles: []PatchFile{{Path: "text", Action: DiffModified}},
+		},
+		{
+			name:    "git_to_index",
+			diff:    "diff --git a/text b/moved\nsimilarity index 90%\nrename from text\nrename to moved\n--- a/text\n+++ b/moved\n@@ -10 +10 @@\n-10\n+ten\n\\ No newline at end of file\ndiff --git a/add/new b/add/new\nnew file mode 100755\n--- /dev/null\n+++ b/add/new\n@@ -0,0 +1 @@\n+new\ndiff --git a/file b/file\ndeleted file mode 100644\n--- a/file\n+++ /dev/null\nBinary files a/file and /dev/null differ\n",
+			toIndex: true,
+			wantFiles: []PatchFile{
+				{Path: "moved", From: "text", Action: DiffRenamed},
+				{Path: "add/new", Action: DiffAdded},
+				{Path: "file", Action: DiffDeleted, Conflict: "binary patch without data"},
+			},
+		},
+		{
+			name:    "rename_add_delete",
+			diff:    "diff --git a/text b/moved\nrename from text\nrename to moved\n--- a/text\n+++ b/moved\n@@ -10 +10 @@\n-10\n+ten\n\\ No newline at end of file\ndiff --git a/add/new b/add/new\nnew file mode 100755\n--- /dev/null\n+++ b/add/new\n@@ -0,0 +1 @@\n+new\ndiff --git a/dir/dir_file b/dir/dir_file\ndeleted file mode 100644\n--- a/dir/dir_file\n+++ /dev/null\n@@ -1 +0,0 @@\n-\x00\x00\n\\ No newline at end of file\n",
+			toIndex: true,
+			want:    map[string]string{"moved": "1\n2\n3\n4\n5\n6\n7\n8\n9\nten", "add/new": "new\n"},
+			status:  []string{"A  add/new", "D  dir/dir_file", "R  text -> moved", ""},
+			wantFiles: []PatchFile{
+				{Path: "moved", From: "text", Action: DiffRenamed},
+				{Path: "add/new", Action: DiffAdded},
+				{Path: "dir/dir_file", Action: DiffDeleted},
+			},
+		},
+		{
+			name: "rejected",
+			diff: "--- a/text\n+++ b/text\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -5,3 +5,3 @@\n 5\n-nope\n+six\n 7\n--- /dev/null\n+++ b/file\n@@ -0,0 +1 @@\n+exists\n",
+			wantFiles: []PatchFile{
+				{Path: "text", Action: DiffModified, Rejected: []string{"@@ -5,3 +5,3 @@"}},
+				{Path: "file", Action: DiffAdded, Conflict: "already exists in working directory"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			c.CommitFiles(map[string][]byte{"text": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")}, "add text")
+			before, _ := c.ReadFilesWith(ReadFilesOpt{})
+			report, err := c.ApplyPatch(tt.diff, tt.toIndex)
+			if err != nil {
+				t.Fatalf("Client.ApplyPatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(report.Files, tt.wantFiles) {
+				t.Errorf("Client.ApplyPatch() = %+v, want %+v", report.Files, tt.wantFiles)
+			}
+			after, _ := c.ReadFilesWith(ReadFilesOpt{})
+			if tt.want == nil {
+				if report.Err() == nil || !reflect.DeepEqual(before, after) {
+					t.Errorf("Client.ApplyPatch() should fail without changes: %v", report.Err())
+				}
+				return
+			}
+			if report.Err() != nil {
+				t.Fatalf("Client.ApplyPatch() report error = %v", report.Err())
+			}
+			for name, content := range tt.want {
+				if string(after[name]) != content {
+					t.Errorf("%s = %q, want %q", name, after[name], content)
+				}
+			}
+			assertion(t, c, map[string][]string{"status": tt.status})
+		})
+	}
+	c := mockInit()
+	c.CommitFiles(map[string][]byte{"text": []byte("1\n")}, "add text")
+	ioutil.WriteFile(filepath.Join(c.opt.DirPath, "text"), []byte("one\n"), 0644)
+	report, err := c.ApplyPatch("--- a/text\n+++ b/text\n@@ -1 +1 @@\n-one\n+uno\n", true)
+	if err != nil || !reflect.DeepEqual(report.Files, []PatchFile{{Path: "text", Action: DiffModified, Conflict: "does not match index"}}) {
+		t.Errorf("Client.ApplyPatch() to index = %+v, %v", report, err)
+	}
+	if fi, err := os.Stat(filepath.Join(c.opt.DirPath, "text")); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("text should be untouched: %v %v", fi, err)
+	}
+}
+
+func TestClient_ApplyPatch_unsafePaths(t *testing.T) {
+	add := func(p string) string {
+		return "--- /dev/null\n+++ b/" + p + "\n@@ -0,0 +1 @@\n+pwned\n"
+	}
+	tests := []struct {
+		name      string
+		diff      string
+		wantFiles []PatchFile
+	}{
+		{name: "parent", diff: add("../OUT/escaped"), wantFiles: []PatchFile{{Path: "../OUT/escaped", Action: DiffAdded, Conflict: "invalid path"}}},
+		{name: "absolute", diff: "diff --git a/ABS/escaped b/ABS/escaped\nnew file mode 100644\n" + add("/ABS/escaped"), wantFiles: []PatchFile{{Path: "ABS/escaped", Action: DiffAdded, Conflict: "absolute path"}}},
+		{name: "delete_parent", diff: "--- a/../OUT/keep\n+++ /dev/null\n@@ -1 +0,0 @@\n-keep\n", wantFiles: []PatchFile{{Path: "../OUT/keep", Action: DiffDeleted, Conflict: "invalid path"}}},
+		{name: "rename_parent", diff: "diff --git a/file b/../OUT/escaped\nrename from file\nrename to ../OUT/escaped\n", wantFiles: []PatchFile{{Path: "../OUT/escaped", From: "file", Action: DiffRenamed, Conflict: "invalid path"}}},
+		{name: "git_dir", diff: add(".git/hooks/pre-commit"), wantFiles: []PatchFile{{Path: ".git/hooks/pre-commit", Action: DiffAdded, Conflict: "invalid path"}}},
+		{name: "symlink", diff: add("link/escaped"), wantFiles: []PatchFile{{Path: "link/escaped", Action: DiffAdded, Conflict: "beyond a symbolic link"}}},
+		{
+			name: "new_symlink",
+			diff: "diff --git a/newlink b/newlink\nnew file mode 120000\n--- /dev/null\n+++ b/newlink\n@@ -0,0 +1 @@\n+ABS\n\\ No newline at end of file\n" + add("newlink/escaped"),
+			wantFiles: []PatchFile{
+				{Path: "newlink", Action: DiffAdded},
+				{Path: "newlink/escaped", Action: DiffAdded, Conflict: "beyond a symbolic link"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			outside, _ := ioutil.TempDir("/tmp", "gtc-")
+			defer os.RemoveAll(outside)
+			ioutil.WriteFile(filepath.Join(outside, "keep"), []byte("keep\n"), 0644)
+			os.Symlink(outside, filepath.Join(c.opt.DirPath, "link"))
+			rel, _ := filepath.Rel(c.opt.DirPath, outside)
+			diff := strings.NewReplacer("OUT", filepath.Base(outside), "/ABS", outside, "ABS", outside).Replace(tt.diff)
+			for i := range tt.wantFiles {
+				tt.wantFiles[i].Path = strings.NewReplacer("../OUT", rel, "ABS", outside).Replace(tt.wantFiles[i].Path)
+			}
+			report, err := c.ApplyPatch(diff, false)
+			if err != nil {
+				t.Fatalf("Client.ApplyPatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(report.Files, tt.wantFiles) || report.Err() == nil {
+				t.Errorf("Client.ApplyPatch() = %+v, want %+v", report.Files, tt.wantFiles)
+			}
+			if files, _ := ioutil.ReadDir(outside); len(files) != 1 || files[0].Name() != "keep" {
+				t.Errorf("outside of the worktree was changed: %v", files)
+			}
+			assertion(t, c, map[string][]string{"status": {"?? link", ""}})
+		})
+	}
+}
+
+func TestClient_ApplyMailbox_fromLines(t *testing.T) {
+	c := mockInit()
+	base := c.mustHash("HEAD")
+	message := "add text\n\nFrom alice Mon to Fri the job runs.\nFrom now on it is weekly.\n"
+	c.CommitFiles(map[string][]byte{"text": []byte("1\n")}, message)
+	c.CommitFiles(map[string][]byte{"text": []byte("2\n")}, "update text")
+	patches, err := c.FormatPatch(base)
+	if err != nil {
+		t.Fatalf("Client.FormatPatch() error = %v", err)
+	}
+	c.gitExec([]string{"checkout", "-q", "-b", "am", base})
+	report, err := c.ApplyMailbox(strings.NewReader(strings.Join(patches, "")))
+	if err != nil || report.Err() != nil || len(report.Commits) != 2 {
+		t.Fatalf("Client.ApplyMailbox() = %v, %v, %v", report, err, report.Err())
+	}
+	if got, want := gitRevParse(t, c, "am^{tree}"), gitRevParse(t, c, "master^{tree}"); got != want {
+		t.Errorf("tree after Client.ApplyMailbox() = %v, want %v", got, want)
+	}
+	if out, _ := c.gitExec([]string{"log", "-1", "--format=%B", "am~1"}); strings.Join(out, "\n") != message+"\n" {
+		t.Errorf("message after Client.ApplyMailbox() = %q, want %q", strings.Join(out, "\n"), message)
+	}
+}
@@ -0,0 +1,199 @@
+package gtc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/pkg/errors"
+)
+
+type Bump int
+
+const (
+	BumpNone Bump = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+func (b Bump) String() string {
+	return [...]string{"none", "patch", "minor", "major"}[b]
+}
+
+// BumpRule bumps the version when Pattern matches a commit message.
+type BumpRule struct {
+	Pattern string
+	Bump    Bump
+}
+
+type VersionOpt struct {
+	// Prefix of version tags, e.g. "v".
+	Prefix string
+	// Rev is the revision to release. Empty means HEAD.
+	Rev string
+	// Rules replace the Conventional Commits rules when given.
+	Rules []BumpRule
+}
+
+type ReleaseOpt struct {
+	VersionOpt
+	// Message annotates the tag. Empty means "Release <tag>".
+	Message string
+	SignKey *openpgp.Entity
+}
+
+var conventionalHeader = regexp.MustCompile(`^(\w+)(\([^)]*\))?(!)?: `)
+
+// NextVersion computes the version following the highest semver tag reachable from Rev,
+// based on the commits made since then. Without tags the base version is 0.0.0.
+func (c *Client) NextVersion(opt VersionOpt) (Version, Bump, error) {
+	rules, err := compileBumpRules(opt.Rules)
+	if err != nil {
+		return Version{}, BumpNone, err
+	}
+	current, tag, err := c.currentVersion(opt)
+	if err != nil {
+		return Version{}, BumpNone, err
+	}
+	rng := opt.Rev
+	if tag != "" {
+		rng = fmt.Sprintf("%s..%s", tag, opt.Rev)
+	}
+	iter, err := c.Log(LogOpt{Range: rng})
+	if err != nil {
+		return Version{}, BumpNone, err
+	}
+	bump := BumpNone
+	if err := iter.ForEach(func(commit Commit) error {
+		b := conventionalBump(commit)
+		if rules != nil {
+			b = customBump(commit, rules)
+		}
+		if b > bump {
+			bump = b
+		}
+		return nil
+	}); err != nil {
+		return Version{}, BumpNone, err
+	}
+	return current.bump(bump), bump, nil
+}
+
+// Release tags Rev with the next version and pushes the tag to origin.
+func (c *Client) Release(opt ReleaseOpt) (string, error) {
+	next, bump, err := c.NextVersion(opt.VersionOpt)
+	if err != nil {
+		return "", err
+	}
+	if bump == BumpNone {
+		return "", errors.New("no commit requires a release")
+	}
+	name := opt.Prefix + next.String()
+	message := opt.Message
+	if message == "" {
+		message = fmt.Sprintf("Release %s", name)
+	}
+	rev := opt.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if _, err := c.CreateTag(name, rev, CreateTagOpt{Message: message, SignKey: opt.SignKey}); err != nil {
+		return "", err
+	}
+	if err := c.PushTags(PushTagsOpt{Names: []string{name}}); err != nil {
+		return "", errors.Wrapf(err, "failed to push %s", name)
+	}
+	return name, nil
+}
+
+// currentVersion returns the highest semver tag reachable from opt.Rev.
+func (c *Client) currentVersion(opt VersionOpt) (Version, string, error) {
+	head, err := c.resolveCommit(opt.Rev)
+	if err != nil {
+		return Version{}, "", err
+	}
+	reachable, err := ancestors(head)
+	if err != nil {
+		return Version{}, "", err
+	}
+	candidates, err := c.tagCandidates(LatestTagOpt{Strategy: TagStrategySemver, Prefix: opt.Prefix})
+	if err != nil {
+		return Version{}, "", err
+	}
+	ret, tag := Version{}, ""
+	for _, cand := range candidates {
+		if reachable[cand.commit.Hash] && (tag == "" || cand.version.Compare(ret) > 0) {
+			ret, tag = *cand.version, cand.ref.Name().String()
+		}
+	}
+	return ret, tag, nil
+}
+
+func (v Version) bump(b Bump) Version {
+	switch b {
+	case BumpMajor:
+		return Version{Major: v.Major + 1}
+	case BumpMinor:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	case BumpPatch:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	return v
+}
+
+// conventionalBump follows https://www.conventionalcommits.org: breaking changes are major,
+// "feat" is minor and "fix" or "perf" are patch.
+func conventionalBump(commit Commit) Bump {
+	lines := strings.Split(commit.Message, "\n")
+	m := conventionalHeader.FindStringSubmatch(lines[0])
+	if m != nil && m[3] == "!" {
+		return BumpMajor
+	}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			return BumpMajor
+		}
+	}
+	if m == nil {
+		return BumpNone
+	}
+	switch strings.ToLower(m[1]) {
+	case "feat":
+		return BumpMinor
+	case "fix", "perf":
+		return BumpPatch
+	}
+	return BumpNone
+}
+
+type bumpRule struct {
+	re   *regexp.Regexp
+	bump Bump
+}
+
+func compileBumpRules(rules []BumpRule) ([]bumpRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	ret := []bumpRule{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bump rule %s", rule.Pattern)
+		}
+		ret = append(ret, bumpRule{re: re, bump: rule.Bump})
+	}
+	return ret, nil
+}
+
+func customBump(commit Commit, rules []bumpRule) Bump {
+	ret := BumpNone
+	for _, rule := range rules {
+		if rule.bump > ret && rule.re.MatchString(commit.Message) {
+			ret = rule.bump
+		}
+	}
+	return ret
+}
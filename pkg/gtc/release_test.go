@@ -0,0 +1,119 @@
+package gtc
+
+import (
+	"testing"
+)
+
+func TestClient_NextVersion(t *testing.T) {
+	mock := func(messages ...string) Client {
+		c := mockWithTags([]string{"v1.2.3"})
+		for i, message := range messages {
+			c.CommitFiles(map[string][]byte{mkTestName(): {byte(i)}}, message)
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		client   Client
+		opt      VersionOpt
+		want     string
+		wantBump Bump
+		wantErr  bool
+	}{
+		{
+			name:     "none",
+			client:   mock("chore: tidy", "docs: readme"),
+			opt:      VersionOpt{Prefix: "v"},
+			want:     "1.2.3",
+			wantBump: BumpNone,
+		},
+		{
+			name:     "patch",
+			client:   mock("fix: bug", "chore: tidy"),
+			opt:      VersionOpt{Prefix: "v"},
+			want:     "1.2.4",
+			wantBump: BumpPatch,
+		},
+		{
+			name:     "minor",
+			client:   mock("fix: bug", "feat(api): new endpoint"),
+			opt:      VersionOpt{Prefix: "v"},
+			want:     "1.3.0",
+			wantBump: BumpMinor,
+		},
+		{
+			name:     "major_bang",
+			client:   mock("feat!: drop old api", "fix: bug"),
+			opt:      VersionOpt{Prefix: "v"},
+			want:     "2.0.0",
+			wantBump: BumpMajor,
+		},
+		{
+			name:     "major_footer",
+			client:   mock("refactor: config\n\nBREAKING CHANGE: config keys are renamed"),
+			opt:      VersionOpt{Prefix: "v"},
+			want:     "2.0.0",
+			wantBump: BumpMajor,
+		},
+		{
+			name:     "no_tag",
+			client:   mockInit(),
+			opt:      VersionOpt{Prefix: "v", Rules: []BumpRule{{Pattern: "^init", Bump: BumpMinor}}},
+			want:     "0.1.0",
+			wantBump: BumpMinor,
+		},
+		{
+			name:     "custom_rules",
+			client:   mock("[minor] add", "[patch] fix"),
+			opt:      VersionOpt{Prefix: "v", Rules: []BumpRule{{Pattern: `^\[minor\]`, Bump: BumpMinor}, {Pattern: `^\[patch\]`, Bump: BumpPatch}}},
+			want:     "1.3.0",
+			wantBump: BumpMinor,
+		},
+		{
+			name:    "ng_rule",
+			client:  mock(),
+			opt:     VersionOpt{Rules: []BumpRule{{Pattern: "("}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			got, bump, err := c.NextVersion(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.NextVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.String() != tt.want || bump != tt.wantBump {
+				t.Errorf("Client.NextVersion() = %v %v, want %v %v", got, bump, tt.want, tt.wantBump)
+			}
+		})
+	}
+}
+
+func TestClient_Release(t *testing.T) {
+	m, _ := NewMock(MockOpt{
+		CurrentBranch: "master",
+		Remote: &MockOpt{
+			CurrentBranch: "master",
+			Commits:       []MockCommit{{Message: "init", Files: map[string][]byte{"file": {0}}}},
+		},
+	})
+	c := m.C
+	c.CreateTag("v1.0.0", "HEAD", CreateTagOpt{})
+	if _, err := c.Release(ReleaseOpt{VersionOpt: VersionOpt{Prefix: "v"}}); err == nil {
+		t.Errorf("Client.Release() should fail without releasable commits")
+	}
+	c.CommitFiles(map[string][]byte{"feature": {1}}, "feat: feature")
+	got, err := c.Release(ReleaseOpt{VersionOpt: VersionOpt{Prefix: "v"}})
+	if err != nil || got != "v1.1.0" {
+		t.Errorf("Client.Release() = %v, %v, want v1.1.0", got, err)
+	}
+	tags, _ := m.RC.ListTags()
+	if len(tags) != 1 || tags[0].Name != "v1.1.0" || tags[0].Message != "Release v1.1.0\n" {
+		t.Errorf("remote tags = %v, want v1.1.0", tags)
+	}
+}
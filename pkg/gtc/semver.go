@@ -0,0 +1,243 @@
+package gtc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Version is a semantic version as defined by https://semver.org.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease []string
+	Build      string
+}
+
+// ParseVersion parses s after stripping prefix, e.g. ParseVersion("v1.2.3", "v").
+func ParseVersion(s, prefix string) (Version, error) {
+	if !strings.HasPrefix(s, prefix) {
+		return Version{}, errors.Errorf("%s does not have prefix %s", s, prefix)
+	}
+	v, partial, err := parseVersion(strings.TrimPrefix(s, prefix))
+	if err != nil {
+		return Version{}, err
+	}
+	if partial < 3 {
+		return Version{}, errors.Errorf("%s is not a full semantic version", s)
+	}
+	return v, nil
+}
+
+// parseVersion also accepts partial versions such as "1" or "1.2" and returns the number of given parts.
+func parseVersion(s string) (Version, int, error) {
+	v := Version{}
+	if i := strings.Index(s, "+"); i >= 0 {
+		s, v.Build = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.Prerelease = s[:i], strings.Split(s[i+1:], ".")
+		for _, p := range v.Prerelease {
+			if p == "" {
+				return Version{}, 0, errors.Errorf("invalid pre-release in %s", s)
+			}
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		return Version{}, 0, errors.Errorf("invalid version %s", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (len(p) > 1 && p[0] == '0') {
+			return Version{}, 0, errors.Errorf("invalid version %s", s)
+		}
+		*nums[i] = n
+	}
+	return v, len(parts), nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 following semver precedence. Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if d := comparePrerelease(v.Prerelease[i], o.Prerelease[i]); d != 0 {
+			return d
+		}
+	}
+	return sign(len(v.Prerelease) - len(o.Prerelease))
+}
+
+func comparePrerelease(a, b string) int {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return sign(an - bn)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// Constraint is a set of version ranges such as ">=1.2 <2 || ^3.1".
+// Comparators separated by spaces must all match, "||" separates alternatives.
+type Constraint struct {
+	groups [][]comparator
+}
+
+type comparator struct {
+	op string
+	v  Version
+}
+
+func ParseConstraint(s string) (Constraint, error) {
+	ret := Constraint{}
+	for _, group := range strings.Split(s, "||") {
+		cs := []comparator{}
+		for _, f := range strings.Fields(group) {
+			parsed, err := parseComparator(f)
+			if err != nil {
+				return Constraint{}, err
+			}
+			cs = append(cs, parsed...)
+		}
+		if len(cs) == 0 {
+			return Constraint{}, errors.Errorf("empty constraint in %s", s)
+		}
+		ret.groups = append(ret.groups, cs)
+	}
+	return ret, nil
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, strings.TrimPrefix(s, o)
+			break
+		}
+	}
+	v, n, err := parseVersion(strings.TrimPrefix(s, "v"))
+	if err != nil {
+		return nil, err
+	}
+	next := func(part int) Version {
+		switch part {
+		case 1:
+			return Version{Major: v.Major + 1}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	switch op {
+	case "~":
+		part := 2
+		if n == 1 {
+			part = 1
+		}
+		return []comparator{{">=", v}, {"<", next(part)}}, nil
+	case "^":
+		part := 1
+		if v.Major == 0 && n > 1 {
+			part = 2
+			if v.Minor == 0 && n > 2 {
+				part = 3
+			}
+		}
+		return []comparator{{">=", v}, {"<", next(part)}}, nil
+	case "", "=":
+		if n < 3 {
+			return []comparator{{">=", v}, {"<", next(n)}}, nil
+		}
+		return []comparator{{"=", v}}, nil
+	case "<=", ">":
+		if n < 3 {
+			// "<=1.2" means below 1.3.0, ">1.2" means from 1.3.0.
+			if op == "<=" {
+				return []comparator{{"<", next(n)}}, nil
+			}
+			return []comparator{{">=", next(n)}}, nil
+		}
+	}
+	return []comparator{{op, v}}, nil
+}
+
+func (c Constraint) Check(v Version) bool {
+	for _, group := range c.groups {
+		ok := true
+		for _, cmp := range group {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) check(v Version) bool {
+	d := v.Compare(c.v)
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package gtc
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		prefix  string
+		want    string
+		wantErr bool
+	}{
+		{name: "ok", s: "1.2.3", want: "1.2.3"},
+		{name: "ok_prefix", s: "v1.2.3", prefix: "v", want: "1.2.3"},
+		{name: "ok_prerelease_build", s: "1.2.3-rc.1+abc", want: "1.2.3-rc.1+abc"},
+		{name: "ng_prefix", s: "1.2.3", prefix: "v", wantErr: true},
+		{name: "ng_partial", s: "1.2", wantErr: true},
+		{name: "ng_leading_zero", s: "1.02.3", wantErr: true},
+		{name: "ng_text", s: "release", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion(tt.s, tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := ParseVersion(ordered[i], "")
+		b, _ := ParseVersion(ordered[i+1], "")
+		if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+			t.Errorf("Version.Compare() %s should be lower than %s", a, b)
+		}
+	}
+}
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.2 <2", "1.2.0", true},
+		{">=1.2 <2", "1.9.9", true},
+		{">=1.2 <2", "2.0.0", false},
+		{">=1.2 <2", "1.1.9", false},
+		{"~1.2", "1.2.9", true},
+		{"~1.2", "1.3.0", false},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^0.2.3", "0.3.0", false},
+		{"1.2", "1.2.5", true},
+		{"<=1.2", "1.2.5", true},
+		{">1.2", "1.2.5", false},
+		{"<1 || >=3", "3.1.0", true},
+		{"<1 || >=3", "2.1.0", false},
+		{"!=1.0.0", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint+"_"+tt.version, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Errorf("ParseConstraint() error = %v", err)
+				return
+			}
+			v, _ := ParseVersion(tt.version, "")
+			if got := c.Check(v); got != tt.want {
+				t.Errorf("Constraint.Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseConstraint(">=x"); err == nil {
+		t.Errorf("ParseConstraint() should fail")
+	}
+}
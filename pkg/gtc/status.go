@@ -0,0 +1,301 @@
+package gtc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+type Status struct {
+	Files []FileStatus `json:"files" yaml:"files"`
+	// Branch is the current branch name. It is empty when HEAD is detached.
+	Branch   string `json:"branch" yaml:"branch"`
+	Upstream string `json:"upstream" yaml:"upstream"`
+	Ahead    int    `json:"ahead" yaml:"ahead"`
+	Behind   int    `json:"behind" yaml:"behind"`
+	// AheadBehindUnknown is set when a shallow history ends before the merge base with Upstream.
+	AheadBehindUnknown bool `json:"aheadBehindUnknown" yaml:"aheadBehindUnknown"`
+}
+
+type FileStatus struct {
+	Path string `json:"path" yaml:"path"`
+	// From is the source path of a staged rename.
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	// Staging and Worktree are the codes of `git status --porcelain`.
+	Staging    string `json:"staging" yaml:"staging"`
+	Worktree   string `json:"worktree" yaml:"worktree"`
+	Untracked  bool   `json:"untracked" yaml:"untracked"`
+	Ignored    bool   `json:"ignored" yaml:"ignored"`
+	Conflicted bool   `json:"conflicted" yaml:"conflicted"`
+}
+
+type StatusOpt struct {
+	// Ignored reports ignored files as well.
+	Ignored bool
+}
+
+type CleanOpt struct {
+	IgnoreUntracked bool
+	// IgnorePaths are glob patterns matched against the path and its base name.
+	IgnorePaths []string
+}
+
+func (c *Client) Status(opt StatusOpt) (Status, error) {
+	ret, err := c.fileStatus(opt, true)
+	if err != nil {
+		return Status{}, err
+	}
+	if err := c.trackingStatus(&ret); err != nil {
+		return Status{}, err
+	}
+	return ret, nil
+}
+
+// fileStatus is Status without the comparison with the upstream.
+// Staged renames are paired only if renames is set, as it costs a diff of HEAD and the index.
+func (c *Client) fileStatus(opt StatusOpt, renames bool) (Status, error) {
+	w, err := c.r.Worktree()
+	if err != nil {
+		return Status{}, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return Status{}, err
+	}
+	files := map[string]*FileStatus{}
+	for p, s := range status {
+		if s.Staging == git.Unmodified && s.Worktree == git.Unmodified {
+			continue
+		}
+		files[p] = &FileStatus{
+			Path:      p,
+			Staging:   string(s.Staging),
+			Worktree:  string(s.Worktree),
+			Untracked: s.Worktree == git.Untracked,
+		}
+	}
+	if renames {
+		if err := c.applyStagedRenames(files); err != nil {
+			return Status{}, err
+		}
+	}
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return Status{}, err
+	}
+	for _, e := range idx.Entries {
+		if e.Stage == 0 {
+			continue
+		}
+		files[e.Name] = &FileStatus{Path: e.Name, Staging: "U", Worktree: "U", Conflicted: true}
+	}
+	if opt.Ignored {
+		ignored, err := c.ignoredFiles(w)
+		if err != nil {
+			return Status{}, err
+		}
+		for _, p := range ignored {
+			files[p] = &FileStatus{Path: p, Staging: "!", Worktree: "!", Ignored: true}
+		}
+	}
+	ret := Status{Files: []FileStatus{}}
+	for _, f := range files {
+		ret.Files = append(ret.Files, *f)
+	}
+	sort.Slice(ret.Files, func(i, j int) bool { return ret.Files[i].Path < ret.Files[j].Path })
+	return ret, nil
+}
+
+// applyStagedRenames merges staged delete/add pairs into renames.
+func (c *Client) applyStagedRenames(files map[string]*FileStatus) error {
+	if _, err := c.r.Head(); err != nil {
+		return nil
+	}
+	diffs, err := c.Diff("HEAD", DiffIndex, DiffOpt{DetectRenames: true, NoPatch: true})
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		if d.Action != DiffRenamed {
+			continue
+		}
+		to, from := files[d.To], files[d.From]
+		if to == nil || from == nil || from.Worktree != string(git.Unmodified) {
+			continue
+		}
+		to.From, to.Staging = d.From, string(git.Renamed)
+		delete(files, d.From)
+	}
+	return nil
+}
+
+func (c *Client) trackingStatus(s *Status) error {
+	head, err := c.r.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return nil
+	}
+	s.Branch = head.Name().Short()
+	upstream, err := c.upstream(s.Branch)
+	if err != nil {
+		return nil
+	}
+	s.Upstream = upstream.Short()
+	if _, err := c.r.Reference(upstream, true); err != nil {
+		return nil
+	}
+	d, err := c.divergence(head.Name(), upstream)
+	if err != nil {
+		return err
+	}
+	s.Ahead, s.Behind, s.AheadBehindUnknown = d.Ahead, d.Behind, d.Unknown
+	return nil
+}
+
+// upstream returns the remote tracking reference of branch, falling back to origin/<branch>.
+func (c *Client) upstream(branch string) (plumbing.ReferenceName, error) {
+	remote, merge, err := c.upstreamBranch(branch)
+	if err != nil {
+		return "", err
+	}
+	return plumbing.NewRemoteReferenceName(remote, merge), nil
+}
+
+// upstreamBranch returns the remote and the remote branch tracked by branch.
+func (c *Client) upstreamBranch(branch string) (string, string, error) {
+	if b, err := c.r.Branch(branch); err == nil && b.Remote != "" && b.Merge != "" {
+		return b.Remote, b.Merge.Short(), nil
+	} else if err != nil && err != git.ErrBranchNotFound {
+		return "", "", err
+	}
+	if _, err := c.r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true); err != nil {
+		return "", "", err
+	}
+	return "origin", branch, nil
+}
+
+func (c *Client) ignoreMatcher(w *git.Worktree) (gitignore.Matcher, error) {
+	patterns, err := gitignore.ReadPatterns(w.Filesystem, nil)
+	if err != nil {
+		return nil, err
+	}
+	patterns = append(patterns, w.Excludes...)
+	// the git directory is not always .git in the worktree, e.g. in a submodule
+	fs, ok := c.r.Storer.(*filesystem.Storage)
+	if !ok {
+		return gitignore.NewMatcher(patterns), nil
+	}
+	f, err := fs.Filesystem().Open(path.Join("info", "exclude"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			patterns = append(patterns, gitignore.ParsePattern(line, nil))
+		}
+	}
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// ignoredFiles lists untracked paths matched by ignore rules. Ignored directories end with "/".
+func (c *Client) ignoredFiles(w *git.Worktree) ([]string, error) {
+	m, err := c.ignoreMatcher(w)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]bool{}
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+	ret := []string{}
+	err = filepath.Walk(c.opt.DirPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.opt.DirPath, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if tracked[rel] || !m.Match(strings.Split(rel, "/"), info.IsDir()) {
+			return nil
+		}
+		if info.IsDir() {
+			ret = append(ret, rel+"/")
+			return filepath.SkipDir
+		}
+		ret = append(ret, rel)
+		return nil
+	})
+	return ret, err
+}
+
+// IsCleanWith reports whether the worktree is clean, skipping untracked files or paths if asked.
+func (c *Client) IsCleanWith(opt CleanOpt) (bool, error) {
+	s, err := c.fileStatus(StatusOpt{}, false)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range s.Files {
+		if f.Untracked && opt.IgnoreUntracked {
+			continue
+		}
+		if matchGlobs(f.Path, opt.IgnorePaths) {
+			continue
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func matchGlobs(p string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Status) IsClean() bool {
+	for _, f := range s.Files {
+		if !f.Ignored {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the status like `git status --porcelain`.
+func (s Status) String() string {
+	lines := []string{}
+	for _, f := range s.Files {
+		p := f.Path
+		if f.From != "" {
+			p = fmt.Sprintf("%s -> %s", f.From, f.Path)
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s", f.Staging, f.Worktree, p))
+	}
+	return strings.Join(lines, "\n")
+}
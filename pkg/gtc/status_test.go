@@ -0,0 +1,197 @@
+package gtc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClient_Status(t *testing.T) {
+	renamed := mockInit()
+	renamed.gitExec([]string{"mv", "file", "moved"})
+	ignored := mockWithUnstagedFile()
+	ignored.CommitFiles(map[string][]byte{".gitignore": []byte("*.log\nbuild/\n")}, "ignore")
+	ignored.addFile("debug.log", []byte("log"))
+	ignored.addFile("build/out", []byte("out"))
+	modified := mockInit()
+	modified.addFile("file", []byte("changed"))
+	super := mockWithSubmodule()
+	os.MkdirAll(filepath.Join(super.opt.DirPath, ".git", "modules", "test", "info"), 0755)
+	ioutil.WriteFile(filepath.Join(super.opt.DirPath, ".git", "modules", "test", "info", "exclude"), []byte("*.log\n"), 0644)
+	ioutil.WriteFile(filepath.Join(super.opt.DirPath, "test", "debug.log"), []byte("log"), 0644)
+	opt := super.opt
+	opt.DirPath = filepath.Join(super.opt.DirPath, "test")
+	submodule, _ := Open(opt)
+	tests := []struct {
+		name    string
+		client  Client
+		opt     StatusOpt
+		want    Status
+		wantErr bool
+	}{
+		{
+			name:   "clean",
+			client: mockInit(),
+			want:   Status{Files: []FileStatus{}, Branch: "master"},
+		},
+		{
+			name:   "modified",
+			client: modified,
+			want: Status{
+				Files:  []FileStatus{{Path: "file", Staging: " ", Worktree: "M"}},
+				Branch: "master",
+			},
+		},
+		{
+			name:   "renamed",
+			client: renamed,
+			want: Status{
+				Files:  []FileStatus{{Path: "moved", From: "file", Staging: "R", Worktree: " "}},
+				Branch: "master",
+			},
+		},
+		{
+			name:   "untracked_and_ignored",
+			client: ignored,
+			opt:    StatusOpt{Ignored: true},
+			want: Status{
+				Files: []FileStatus{
+					{Path: "build/", Staging: "!", Worktree: "!", Ignored: true},
+					{Path: "debug.log", Staging: "!", Worktree: "!", Ignored: true},
+					{Path: "file_mockwithunstagedfile", Staging: "?", Worktree: "?", Untracked: true},
+				},
+				Branch: "master",
+			},
+		},
+		{
+			name:   "submodule_info_exclude",
+			client: submodule,
+			opt:    StatusOpt{Ignored: true},
+			want: Status{
+				Files:    []FileStatus{{Path: "debug.log", Staging: "!", Worktree: "!", Ignored: true}},
+				Branch:   "master",
+				Upstream: "origin/master",
+			},
+		},
+		{
+			name:   "conflicted",
+			client: mockWithConflict(),
+			want: Status{
+				Files:  []FileStatus{{Path: "file", Staging: "U", Worktree: "U", Conflicted: true}},
+				Branch: "master",
+			},
+		},
+		{
+			name:   "ahead",
+			client: mockWithRemoteAndDirty(),
+			want:   Status{Files: []FileStatus{}, Branch: "master", Upstream: "origin/master", Ahead: 1},
+		},
+		{
+			name:   "behind",
+			client: mockWithFetchedBehind(),
+			want:   Status{Files: []FileStatus{}, Branch: "master", Upstream: "origin/master", Behind: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			got, err := c.Status(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Status() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Client.Status() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_Status_shallow(t *testing.T) {
+	src := mockWithHistory()
+	opt := mockOpt()
+	opt.OriginURL = src.opt.DirPath
+	c, err := Clone(opt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clean, err := c.IsClean(); err != nil || !clean {
+		t.Errorf("Client.IsClean() = %v, %v", clean, err)
+	}
+	if err := c.CommitFiles(map[string][]byte{"local": {1}}, "local"); err != nil {
+		t.Fatalf("Client.CommitFiles() error = %v", err)
+	}
+	got, err := c.Status(StatusOpt{})
+	if diff := cmp.Diff(Status{Files: []FileStatus{}, Branch: "master", Upstream: "origin/master", Ahead: 1}, got); err != nil || diff != "" {
+		t.Errorf("Client.Status() mismatch (-want +got): %v\n%s", err, diff)
+	}
+	src.CommitFiles(map[string][]byte{"remote": {2}}, "remote")
+	if out, err := c.gitExec([]string{"fetch", "-q", "--depth=1", "origin"}); err != nil {
+		t.Fatalf("git fetch: %v", out)
+	}
+	got, err = c.Status(StatusOpt{})
+	if diff := cmp.Diff(Status{Files: []FileStatus{}, Branch: "master", Upstream: "origin/master", AheadBehindUnknown: true}, got); err != nil || diff != "" {
+		t.Errorf("Client.Status() mismatch (-want +got): %v\n%s", err, diff)
+	}
+}
+
+func TestClient_IsCleanWith(t *testing.T) {
+	modified := mockInit()
+	modified.addFile("dir/dir_file", []byte("changed"))
+	renamed := mockInit()
+	renamed.gitExec([]string{"mv", "file", "moved"})
+	tests := []struct {
+		name    string
+		client  Client
+		opt     CleanOpt
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "dirty_untracked",
+			client: mockWithUnstagedFile(),
+			opt:    CleanOpt{},
+			want:   false,
+		},
+		{
+			name:   "ignore_untracked",
+			client: mockWithUnstagedFile(),
+			opt:    CleanOpt{IgnoreUntracked: true},
+			want:   true,
+		},
+		{
+			name:   "ignore_paths",
+			client: modified,
+			opt:    CleanOpt{IgnorePaths: []string{"dir/*"}},
+			want:   true,
+		},
+		{
+			name:   "staged_rename",
+			client: renamed,
+			opt:    CleanOpt{},
+			want:   false,
+		},
+		{
+			name:   "ignore_paths_unmatched",
+			client: modified,
+			opt:    CleanOpt{IgnorePaths: []string{"*.txt"}},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			got, err := c.IsCleanWith(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.IsCleanWith() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Client.IsCleanWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
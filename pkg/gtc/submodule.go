@@ -0,0 +1,944 @@
+package gtc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+// SubmoduleSetURL changes the url of the submodule at path in .gitmodules and syncs it.
+func (c *Client) SubmoduleSetURL(path, url string) error {
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	s, err := submoduleSection(modules, path)
+	if err != nil {
+		return err
+	}
+	s.SetOption("url", url)
+	if err := c.writeGitmodules(modules); err != nil {
+		return err
+	}
+	return c.syncSubmodule(s.Name, url)
+}
+
+// SubmoduleSetBranch changes the tracking branch of the submodule at path in .gitmodules.
+// An empty branch removes the setting.
+func (c *Client) SubmoduleSetBranch(path, branch string) error {
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	s, err := submoduleSection(modules, path)
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		s.RemoveOption("branch")
+	} else {
+		s.SetOption("branch", branch)
+	}
+	return c.writeGitmodules(modules)
+}
+
+// SubmoduleSync copies the urls in .gitmodules to .git/config and to the origin of each submodule.
+func (c *Client) SubmoduleSync() error {
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	for _, s := range modules.Section("submodule").Subsections {
+		if err := c.syncSubmodule(s.Name, s.Option("url")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSubmodule clones url into .git/modules/<name>, checks out revision at name
+// and stages .gitmodules and the gitlink. originURL is used only for the clone.
+func (c *Client) addSubmodule(name, url, originURL, revision string, auth transport.AuthMethod) error {
+	if _, err := os.Lstat(filepath.Join(c.opt.DirPath, name)); err == nil {
+		return errors.Errorf("%s already exists", name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, e := range idx.Entries {
+		if e.Name == name || strings.HasPrefix(e.Name, name+"/") {
+			return errors.Errorf("%s already exists in the index", name)
+		}
+	}
+	modulesDir := filepath.Join(c.opt.DirPath, ".git", "modules")
+	if _, err := os.Lstat(filepath.Join(modulesDir, name)); err == nil {
+		return errors.Errorf("a git directory for %s already exists", name)
+	}
+	created := []string{missingRoot(c.opt.DirPath, name), missingRoot(modulesDir, name)}
+	head, err := c.cloneSubmodule(name, originURL, revision, auth)
+	if err != nil {
+		for _, dir := range created {
+			os.RemoveAll(dir)
+		}
+		return err
+	}
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	s := modules.Section("submodule").Subsection(name)
+	s.SetOption("path", name)
+	s.SetOption("url", url)
+	if revision != "" {
+		s.SetOption("branch", revision)
+	}
+	if err := c.writeGitmodules(modules); err != nil {
+		return err
+	}
+	cfg, err := c.r.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Submodules[name] = &config.Submodule{Name: name, URL: url}
+	if err := c.r.Storer.SetConfig(cfg); err != nil {
+		return err
+	}
+	if err := c.syncSubmodule(name, url); err != nil {
+		return err
+	}
+	if err := c.Add(gitmodulesFile); err != nil {
+		return err
+	}
+	idx, err = c.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	e, err := idx.Entry(name)
+	if err == index.ErrEntryNotFound {
+		e = idx.Add(name)
+	} else if err != nil {
+		return err
+	}
+	e.Hash, e.Mode = head, filemode.Submodule
+	sort.Slice(idx.Entries, func(i, j int) bool { return idx.Entries[i].Name < idx.Entries[j].Name })
+	return c.r.Storer.SetIndex(idx)
+}
+
+// missingRoot returns the topmost directory of the slash separated p below root that
+// does not exist yet, so that a failed command removes only what it created.
+func missingRoot(root, p string) string {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		dir := filepath.Join(root, filepath.Join(parts[:i+1]...))
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			return dir
+		}
+	}
+	return filepath.Join(root, p)
+}
+
+func (c *Client) cloneSubmodule(name, url, revision string, auth transport.AuthMethod) (plumbing.Hash, error) {
+	ms, ok := c.r.Storer.(storage.ModuleStorer)
+	if !ok {
+		return plumbing.ZeroHash, errors.New("storage does not support submodules")
+	}
+	st, err := ms.Module(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	fs, err := w.Filesystem.Chroot(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	sr, err := git.Init(st, fs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	remote, err := sr.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := remote.Fetch(&git.FetchOptions{Auth: auth}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, errors.Wrapf(err, "failed to fetch %s", url)
+	}
+	if revision == "" {
+		if revision, err = remoteHeadBranch(remote, auth); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	ref, err := sr.Reference(plumbing.NewRemoteReferenceName("origin", revision), true)
+	if err != nil {
+		return plumbing.ZeroHash, errors.Wrapf(err, "failed to find branch %s in %s", revision, url)
+	}
+	branch := plumbing.NewBranchReferenceName(revision)
+	if err := sr.CreateBranch(&config.Branch{Name: revision, Remote: "origin", Merge: branch}); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	sw, err := sr.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := sw.Checkout(&git.CheckoutOptions{Branch: branch, Hash: ref.Hash(), Create: true}); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return ref.Hash(), nil
+}
+
+func remoteHeadBranch(remote *git.Remote, auth transport.AuthMethod) (string, error) {
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+	return "", errors.New("failed to find the default branch")
+}
+
+// syncSubmodule sets url to .git/config and to the origin of the submodule if it is initialized.
+func (c *Client) syncSubmodule(name, url string) error {
+	cfg, err := c.r.Config()
+	if err != nil {
+		return err
+	}
+	s, ok := cfg.Submodules[name]
+	if !ok {
+		return nil
+	}
+	s.URL = url
+	if err := c.r.Storer.SetConfig(cfg); err != nil {
+		return err
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return err
+	}
+	sub, err := w.Submodule(name)
+	if err != nil {
+		return err
+	}
+	sr, err := sub.Repository()
+	if err != nil {
+		return err
+	}
+	scfg, err := sr.Config()
+	if err != nil {
+		return err
+	}
+	if origin, ok := scfg.Remotes["origin"]; ok {
+		origin.URLs = []string{url}
+		return sr.Storer.SetConfig(scfg)
+	}
+	return nil
+}
+
+func (c *Client) readGitmodules() (*format.Config, error) {
+	ret := format.New()
+	b, err := ioutil.ReadFile(filepath.Join(c.opt.DirPath, gitmodulesFile))
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := format.NewDecoder(bytes.NewReader(b)).Decode(ret); err != nil {
+		return nil, errors.Wrap(err, "failed to parse .gitmodules")
+	}
+	return ret, nil
+}
+
+func (c *Client) writeGitmodules(modules *format.Config) error {
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(modules); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(c.opt.DirPath, gitmodulesFile), buf.Bytes(), 0644)
+}
+
+// submoduleSection finds the submodule by path, or by name as git does.
+func submoduleSection(modules *format.Config, path string) (*format.Subsection, error) {
+	path = cleanPath(path)
+	for _, s := range modules.Section("submodule").Subsections {
+		if s.Option("path") == path {
+			return s, nil
+		}
+	}
+	if modules.Section("submodule").HasSubsection(path) {
+		return modules.Section("submodule").Subsection(path), nil
+	}
+	return nil, errors.Errorf("no submodule mapping found for %s", path)
+}
+
+// submoduleDirs returns the name and path of s, refusing those which would take the
+// submodule worktree or its repository in .git/modules outside of their directory.
+func submoduleDirs(s *format.Subsection) (string, string, error) {
+	path := s.Option("path")
+	if !isRelativePath(path) {
+		return "", "", errors.Errorf("invalid path %q for submodule %s", path, s.Name)
+	}
+	if !isRelativePath(s.Name) {
+		return "", "", errors.Errorf("invalid submodule name %q", s.Name)
+	}
+	return s.Name, path, nil
+}
+
+// isRelativePath reports whether p is a non-empty slash separated path inside the
+// worktree and out of .git.
+func isRelativePath(p string) bool {
+	if p == "" || filepath.IsAbs(p) {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." || strings.EqualFold(part, ".git") {
+			return false
+		}
+	}
+	return true
+}
+
+// SubmoduleDeinit unregisters the submodule from .git/config and empties its worktree
+// like git submodule deinit. The cloned repository in .git/modules is kept.
+func (c *Client) SubmoduleDeinit(name string) error {
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	s, err := submoduleSection(modules, name)
+	if err != nil {
+		return err
+	}
+	name, path, err := submoduleDirs(s)
+	if err != nil {
+		return err
+	}
+	return c.deinitSubmodule(name, path)
+}
+
+// SubmoduleRemove deinits the submodule, removes it from .gitmodules, the index
+// and .git/modules, and stages the result.
+func (c *Client) SubmoduleRemove(name string) error {
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return err
+	}
+	s, err := submoduleSection(modules, name)
+	if err != nil {
+		return err
+	}
+	name, path, err := submoduleDirs(s)
+	if err != nil {
+		return err
+	}
+	if err := c.deinitSubmodule(name, path); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(c.opt.DirPath, path)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(c.opt.DirPath, ".git", "modules", name)); err != nil {
+		return err
+	}
+	modules.RemoveSubsection("submodule", name)
+	if err := c.writeGitmodules(modules); err != nil {
+		return err
+	}
+	if err := c.Add(gitmodulesFile); err != nil {
+		return err
+	}
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	if _, err := idx.Remove(path); err != nil && err != index.ErrEntryNotFound {
+		return err
+	}
+	return c.r.Storer.SetIndex(idx)
+}
+
+func (c *Client) deinitSubmodule(name, path string) error {
+	cfg, err := c.r.Config()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Submodules[name]; !ok {
+		return nil
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return err
+	}
+	sub, err := w.Submodule(name)
+	if err != nil {
+		return err
+	}
+	if sr, err := sub.Repository(); err == nil {
+		sw, err := sr.Worktree()
+		if err != nil {
+			return err
+		}
+		status, err := sw.Status()
+		if err != nil {
+			return err
+		}
+		if !status.IsClean() {
+			return errors.Errorf("submodule %s contains local modifications", path)
+		}
+	}
+	dir := filepath.Join(c.opt.DirPath, path)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	delete(cfg.Submodules, name)
+	return c.r.Storer.SetConfig(cfg)
+}
+
+type SubmoduleUpdateOpt struct {
+	// Remote checks out the tracked remote branch instead of the recorded commit.
+	Remote bool
+	// Concurrency is the number of submodules updated at once. Zero means 1.
+	Concurrency int
+	// FailFast stops starting updates after the first failure.
+	FailFast bool
+	// Depth is the number of nested levels updated below the first one. Negative means no limit.
+	Depth int
+}
+
+type SubmoduleResult struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+	// Branch is the tracked branch of remote updates.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// Hash is the checked out commit after the update.
+	Hash    string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	Skipped bool   `json:"skipped" yaml:"skipped"`
+	Err     error  `json:"-" yaml:"-"`
+	// Submodules are the results of nested submodules keyed by path like Info.Submodules.
+	Submodules map[string]SubmoduleResult `json:"submodules,omitempty" yaml:"submodules,omitempty"`
+}
+
+// SubmoduleReport holds one result per submodule, sorted by path.
+type SubmoduleReport struct {
+	Results []SubmoduleResult `json:"results" yaml:"results"`
+}
+
+// Err aggregates the failures of the report including nested submodules.
+// Skipped submodules are not failures.
+func (r SubmoduleReport) Err() error {
+	missing, failed := []string{}, []string{}
+	collectSubmoduleErrors("", r.Results, &missing, &failed)
+	msgs := []string{}
+	if len(missing) > 0 {
+		msgs = append(msgs, fmt.Sprintf("remote branch was not found in submodules: %s", strings.Join(missing, ", ")))
+	}
+	if len(failed) > 0 {
+		msgs = append(msgs, fmt.Sprintf("failed to update submodules: %s", strings.Join(failed, "; ")))
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func collectSubmoduleErrors(prefix string, results []SubmoduleResult, missing, failed *[]string) {
+	for _, res := range results {
+		name := prefix + res.Name
+		switch {
+		case res.Err == nil:
+		case errors.Cause(res.Err) == plumbing.ErrReferenceNotFound && res.Branch != "":
+			*missing = append(*missing, fmt.Sprintf("%s (%s)", name, res.Branch))
+		default:
+			*failed = append(*failed, fmt.Sprintf("%s: %v", name, res.Err))
+		}
+		collectSubmoduleErrors(prefix+res.Path+"/", res.nested(), missing, failed)
+	}
+}
+
+// nested returns the results of nested submodules sorted by path.
+func (r SubmoduleResult) nested() []SubmoduleResult {
+	ret := []SubmoduleResult{}
+	for _, res := range r.Submodules {
+		ret = append(ret, res)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
+
+func (r SubmoduleResult) failed() bool {
+	if r.Err != nil {
+		return true
+	}
+	for _, res := range r.Submodules {
+		if res.failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// SubmoduleUpdateWith updates submodules with a pool of workers. Auth and init are
+// applied one by one first since they write the config of the parent.
+func (c *Client) SubmoduleUpdateWith(opt SubmoduleUpdateOpt) (SubmoduleReport, error) {
+	w, err := c.r.Worktree()
+	if err != nil {
+		return SubmoduleReport{}, err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return SubmoduleReport{}, err
+	}
+	sort.Slice(submodules, func(i, j int) bool { return submodules[i].Config().Path < submodules[j].Config().Path })
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return SubmoduleReport{}, err
+	}
+	report := SubmoduleReport{Results: make([]SubmoduleResult, len(submodules))}
+	for i, sub := range submodules {
+		if err := c.SubmoduleUpdateAuth(sub.Config().Name, sub.Config().URL, &c.opt.Auth); err != nil {
+			logrus.Error(err)
+		}
+		if err := sub.Init(); err != nil && err != git.ErrSubmoduleAlreadyInitialized {
+			return SubmoduleReport{}, err
+		}
+		report.Results[i] = SubmoduleResult{Name: sub.Config().Name, Path: sub.Config().Path}
+		if opt.Remote {
+			report.Results[i].Branch = c.submoduleBranch(modules, sub.Config().Name, sub.Config().Path)
+		}
+	}
+	concurrency := opt.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var failed int32
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for n := 0; n < concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := &report.Results[i]
+				if opt.FailFast && atomic.LoadInt32(&failed) > 0 {
+					res.Skipped = true
+					continue
+				}
+				res.Err = c.updateSubmodule(submodules[i], res, opt)
+				if res.failed() {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	for i := range submodules {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return report, nil
+}
+
+// updateSubmodule retries when a reference was changed concurrently,
+// then descends into nested submodules while opt.Depth allows.
+func (c *Client) updateSubmodule(sub *git.Submodule, res *SubmoduleResult, opt SubmoduleUpdateOpt) error {
+	for {
+		var err error
+		if opt.Remote {
+			err = c.submoduleCheckoutRemote(sub, res.Branch)
+		} else {
+			err = c.submoduleUpdateLocal(sub)
+		}
+		if err != storage.ErrReferenceHasChanged {
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	sr, err := sub.Repository()
+	if err != nil {
+		return err
+	}
+	head, err := sr.Head()
+	if err != nil {
+		return err
+	}
+	res.Hash = head.Hash().String()
+	if opt.Depth == 0 {
+		return nil
+	}
+	nested := c.submoduleClient(res.Path, sr, res.Branch)
+	opt.Depth--
+	report, err := nested.SubmoduleUpdateWith(opt)
+	if err != nil {
+		return err
+	}
+	if len(report.Results) > 0 {
+		res.Submodules = map[string]SubmoduleResult{}
+		for _, r := range report.Results {
+			res.Submodules[r.Path] = r
+		}
+	}
+	return nil
+}
+
+// submoduleClient shares the author and auth of c with the submodule at path.
+// Branch overrides prefixed with path apply to its own submodules.
+func (c *Client) submoduleClient(path string, sr *git.Repository, branch string) Client {
+	opt := c.opt
+	opt.DirPath = filepath.Join(c.opt.DirPath, path)
+	opt.OriginURL = ""
+	if branch != "" {
+		opt.Revision = branch
+	}
+	opt.SubmoduleBranches = map[string]string{}
+	for key, b := range c.opt.SubmoduleBranches {
+		if strings.HasPrefix(key, path+"/") {
+			opt.SubmoduleBranches[strings.TrimPrefix(key, path+"/")] = b
+		}
+	}
+	return Client{opt: opt, r: sr}
+}
+
+type SubmoduleSyncOpt struct {
+	// Message is the subject of the bump commit. Empty means "Bump submodules".
+	Message string
+	// DryRun only fetches submodules and returns the planned bumps.
+	// Uninitialized submodules are not planned.
+	DryRun bool
+	// Branch commits the bump on a new branch and pushes it instead of the current branch.
+	// The worktree and the index stay on the current branch.
+	Branch string
+}
+
+// SubmoduleBump is a gitlink moving From one commit To another. From is empty for new gitlinks.
+type SubmoduleBump struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+	// Subjects are the commit subjects in From..To, newest first.
+	Subjects []string `json:"subjects" yaml:"subjects"`
+}
+
+// SubmoduleSyncUpToDateWith moves every submodule to its tracked remote branch,
+// then commits only the changed gitlinks and pushes. Other staged changes stay staged.
+func (c *Client) SubmoduleSyncUpToDateWith(opt SubmoduleSyncOpt) ([]SubmoduleBump, error) {
+	if !opt.DryRun {
+		if err := c.SubmoduleUpdate(true); err != nil {
+			return nil, err
+		}
+	}
+	bumps, err := c.submoduleBumps(opt.DryRun)
+	if err != nil || opt.DryRun || len(bumps) == 0 {
+		return bumps, err
+	}
+	branch := plumbing.NewBranchReferenceName(opt.Branch)
+	if opt.Branch != "" {
+		if _, err := c.r.Reference(branch, false); err == nil {
+			return nil, errors.Errorf("branch %s already exists", opt.Branch)
+		}
+	}
+	head, err := c.r.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := c.commitGitlinks(head.Hash(), bumps, submoduleBumpMessage(opt.Message, bumps))
+	if err != nil {
+		return nil, err
+	}
+	if opt.Branch == "" {
+		name := plumbing.HEAD
+		if head.Name().IsBranch() {
+			name = head.Name()
+		}
+		if err := c.r.Storer.SetReference(plumbing.NewHashReference(name, commit)); err != nil {
+			return nil, err
+		}
+		if err := c.stageGitlinks(bumps, false); err != nil {
+			return nil, err
+		}
+		return bumps, c.Push()
+	}
+	if err := c.r.Storer.SetReference(plumbing.NewHashReference(branch, commit)); err != nil {
+		return nil, err
+	}
+	if err := c.r.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       c.opt.Auth.AuthMethod,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", branch, branch))},
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		// drop the branch so that the sync can be retried
+		c.r.Storer.RemoveReference(branch)
+		return nil, err
+	}
+	return bumps, nil
+}
+
+// commitGitlinks stores a commit on parent that changes only the gitlinks of bumps,
+// plus the staged .gitmodules when a gitlink is new.
+func (c *Client) commitGitlinks(parent plumbing.Hash, bumps []SubmoduleBump, message string) (plumbing.Hash, error) {
+	commit, err := c.r.CommitObject(parent)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	set := func(path string, mode filemode.FileMode, hash plumbing.Hash) error {
+		h, err := c.setTreeEntry(tree, strings.Split(path, "/"), mode, hash)
+		if err != nil {
+			return err
+		}
+		tree, err = c.r.TreeObject(h)
+		return err
+	}
+	added := false
+	for _, bump := range bumps {
+		if err := set(bump.Path, filemode.Submodule, plumbing.NewHash(bump.To)); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		added = added || bump.From == ""
+	}
+	if added {
+		idx, err := c.r.Storer.Index()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if e, err := idx.Entry(gitmodulesFile); err == nil {
+			if err := set(gitmodulesFile, e.Mode, e.Hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+	}
+	sig := object.Signature{Name: c.opt.AuthorName, Email: c.opt.AuthorEmail, When: time.Now()}
+	return c.storeCommit(&object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message,
+		TreeHash:     tree.Hash,
+		ParentHashes: []plumbing.Hash{parent},
+	})
+}
+
+// submoduleBumps compares the gitlinks of HEAD with the checked out commits of submodules,
+// or with their remote branches when fetch is true.
+func (c *Client) submoduleBumps(fetch bool) ([]SubmoduleBump, error) {
+	w, err := c.r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(submodules, func(i, j int) bool { return submodules[i].Config().Path < submodules[j].Config().Path })
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return nil, err
+	}
+	head, err := c.resolveCommit("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	tree, err := head.Tree()
+	if err != nil {
+		return nil, err
+	}
+	ret := []SubmoduleBump{}
+	for _, sub := range submodules {
+		name, path := sub.Config().Name, sub.Config().Path
+		bump := SubmoduleBump{Name: name, Path: path, Subjects: []string{}}
+		if e, err := tree.FindEntry(path); err == nil {
+			bump.From = e.Hash.String()
+		}
+		var sr *git.Repository
+		var to plumbing.Hash
+		if fetch {
+			if sr, to, err = c.submoduleFetchRemote(sub, c.submoduleBranch(modules, name, path)); err == git.ErrSubmoduleNotInitialized {
+				continue
+			}
+		} else if sr, err = sub.Repository(); err == nil {
+			var ref *plumbing.Reference
+			if ref, err = sr.Head(); err == nil {
+				to = ref.Hash()
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve submodule %s", name)
+		}
+		if bump.To = to.String(); bump.To == bump.From {
+			continue
+		}
+		if bump.From != "" {
+			sc := c.submoduleClient(path, sr, "")
+			if commits, err := sc.logList(fmt.Sprintf("%s..%s", bump.From, bump.To)); err == nil {
+				for _, commit := range commits {
+					bump.Subjects = append(bump.Subjects, strings.Split(commit.Message, "\n")[0])
+				}
+			}
+		}
+		ret = append(ret, bump)
+	}
+	return ret, nil
+}
+
+// stageGitlinks sets the gitlinks of bumps to To, or back to From when revert is true.
+func (c *Client) stageGitlinks(bumps []SubmoduleBump, revert bool) error {
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, bump := range bumps {
+		h := bump.To
+		if revert {
+			h = bump.From
+		}
+		if h == "" {
+			if _, err := idx.Remove(bump.Path); err != nil && err != index.ErrEntryNotFound {
+				return err
+			}
+			continue
+		}
+		e, err := idx.Entry(bump.Path)
+		if err == index.ErrEntryNotFound {
+			e = idx.Add(bump.Path)
+		} else if err != nil {
+			return err
+		}
+		e.Hash, e.Mode = plumbing.NewHash(h), filemode.Submodule
+	}
+	sort.Slice(idx.Entries, func(i, j int) bool { return idx.Entries[i].Name < idx.Entries[j].Name })
+	return c.r.Storer.SetIndex(idx)
+}
+
+func submoduleBumpMessage(subject string, bumps []SubmoduleBump) string {
+	if subject == "" {
+		subject = "Bump submodules"
+	}
+	buf := bytes.NewBufferString(subject + "\n")
+	for _, bump := range bumps {
+		if bump.From == "" {
+			fmt.Fprintf(buf, "\n* %s: add %s\n", bump.Path, bump.To[:7])
+			continue
+		}
+		fmt.Fprintf(buf, "\n* %s: %s..%s\n", bump.Path, bump.From[:7], bump.To[:7])
+		for _, s := range bump.Subjects {
+			fmt.Fprintf(buf, "  - %s\n", s)
+		}
+	}
+	return buf.String()
+}
+
+// SubmoduleState is the drift of a submodule. Recorded is the gitlink in the index,
+// Current is the checked out commit and Remote is the tip of the tracking branch.
+// The embedded Divergence compares Recorded with Remote.
+type SubmoduleState struct {
+	Name        string `json:"name" yaml:"name"`
+	Path        string `json:"path" yaml:"path"`
+	Branch      string `json:"branch" yaml:"branch"`
+	Recorded    string `json:"recorded" yaml:"recorded"`
+	Current     string `json:"current" yaml:"current"`
+	Remote      string `json:"remote" yaml:"remote"`
+	Initialized bool   `json:"initialized" yaml:"initialized"`
+	// Modified means Current differs from Recorded like "+" of git submodule status.
+	Modified bool `json:"modified" yaml:"modified"`
+	// Dirty means the worktree of the submodule has local changes.
+	Dirty bool `json:"dirty" yaml:"dirty"`
+	Divergence
+}
+
+// SubmoduleStatus fetches every initialized submodule and reports its state, sorted by path.
+func (c *Client) SubmoduleStatus() ([]SubmoduleState, error) {
+	w, err := c.r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(submodules, func(i, j int) bool { return submodules[i].Config().Path < submodules[j].Config().Path })
+	modules, err := c.readGitmodules()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	ret := []SubmoduleState{}
+	for _, sub := range submodules {
+		name, path := sub.Config().Name, sub.Config().Path
+		state := SubmoduleState{Name: name, Path: path, Branch: c.submoduleBranch(modules, name, path)}
+		if e, err := idx.Entry(path); err == nil {
+			state.Recorded = e.Hash.String()
+		}
+		// the fetched repository is used for everything else since go-git caches packfiles per instance
+		sr, remote, err := c.submoduleFetchRemote(sub, state.Branch)
+		if err == git.ErrSubmoduleNotInitialized {
+			ret = append(ret, state)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch submodule %s", name)
+		}
+		state.Initialized, state.Remote = true, remote.String()
+		if head, err := sr.Head(); err == nil {
+			state.Current = head.Hash().String()
+		}
+		state.Modified = state.Current != state.Recorded
+		sw, err := sr.Worktree()
+		if err != nil {
+			return nil, err
+		}
+		status, err := sw.Status()
+		if err != nil {
+			return nil, err
+		}
+		state.Dirty = !status.IsClean()
+		if state.Recorded != "" {
+			sc := c.submoduleClient(path, sr, state.Branch)
+			cmp, err := sc.Compare(state.Recorded, state.Remote)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to compare submodule %s", name)
+			}
+			state.Divergence = cmp.Divergence
+		}
+		state.Upstream = "origin/" + state.Branch
+		ret = append(ret, state)
+	}
+	return ret, nil
+}
@@ -0,0 +1,635 @@
+package gtc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestClient_SubmoduleAdd_local(t *testing.T) {
+	sub := mockWithRemote()
+	tests := []struct {
+		name     string
+		revision string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "ok",
+			revision: "master",
+			want:     "[submodule \"test\"]\n\tpath = test\n\turl = " + sub.opt.OriginURL + "\n\tbranch = master\n",
+		},
+		{
+			name: "ok_default_branch",
+			want: "[submodule \"test\"]\n\tpath = test\n\turl = " + sub.opt.OriginURL + "\n",
+		},
+		{
+			name:     "ng_branch",
+			revision: "ng-branch",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			if err := c.SubmoduleAdd("test", sub.opt.OriginURL, tt.revision, nil); (err != nil) != tt.wantErr {
+				t.Errorf("Client.SubmoduleAdd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				for _, p := range []string{"test", ".git/modules/test", ".gitmodules"} {
+					if _, err := os.Stat(filepath.Join(c.opt.DirPath, p)); !os.IsNotExist(err) {
+						t.Errorf("%s should be cleaned up", p)
+					}
+				}
+				return
+			}
+			b, _ := ioutil.ReadFile(filepath.Join(c.opt.DirPath, ".gitmodules"))
+			if string(b) != tt.want {
+				t.Errorf(".gitmodules = %q, want %q", b, tt.want)
+			}
+			b, _ = ioutil.ReadFile(filepath.Join(c.opt.DirPath, "test", ".git"))
+			if string(b) != "gitdir: ../.git/modules/test\n" {
+				t.Errorf("test/.git = %q", b)
+			}
+			assertion(t, c, map[string][]string{
+				"status": {"A  .gitmodules", "A  test", ""},
+			})
+			out, err := c.gitExec([]string{"submodule", "status"})
+			if err != nil || !strings.HasSuffix(out[0], " test (heads/master)") {
+				t.Errorf("git submodule status = %v, %v", out, err)
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleAdd_refused(t *testing.T) {
+	sub := mockWithRemote()
+	tests := []struct {
+		name   string
+		path   string
+		url    string
+		modify func(c Client)
+		// kept are files that must survive the failed add
+		kept []string
+	}{
+		{
+			name:   "existing_dir",
+			path:   "vendor",
+			url:    "/nonexistent/repo",
+			modify: func(c Client) { c.addFile("vendor/user", []byte("mine")) },
+			kept:   []string{"vendor/user"},
+		},
+		{
+			name:   "existing_file",
+			path:   "file",
+			url:    sub.opt.OriginURL,
+			modify: func(c Client) {},
+			kept:   []string{"file"},
+		},
+		{
+			name:   "indexed",
+			path:   "dir",
+			url:    sub.opt.OriginURL,
+			modify: func(c Client) { os.RemoveAll(filepath.Join(c.opt.DirPath, "dir")) },
+		},
+		{
+			name: "git_dir",
+			path: "test",
+			url:  sub.opt.OriginURL,
+			modify: func(c Client) {
+				ioutil.WriteFile(filepath.Join(c.opt.DirPath, ".git", "modules", "test", "user"), []byte("mine"), 0644)
+			},
+			kept: []string{".git/modules/test/user"},
+		},
+		{name: "parent", path: "../outside", url: "/nonexistent/repo", modify: func(c Client) {}},
+		{name: "absolute", path: "/tmp/outside", url: "/nonexistent/repo", modify: func(c Client) {}},
+		{name: "dot_git", path: "x/.git", url: "/nonexistent/repo", modify: func(c Client) {}},
+		{
+			name:   "failed_clone_in_existing_dir",
+			path:   "dir/sub/module",
+			url:    "/nonexistent/repo",
+			modify: func(c Client) {},
+			kept:   []string{"dir/dir_file"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			os.MkdirAll(filepath.Join(c.opt.DirPath, ".git", "modules", "test"), 0755)
+			outside := filepath.Join(filepath.Dir(c.opt.DirPath), "outside")
+			os.MkdirAll(outside, 0755)
+			defer os.RemoveAll(outside)
+			tt.modify(c)
+			if err := c.SubmoduleAdd(tt.path, tt.url, "", nil); err == nil {
+				t.Fatal("Client.SubmoduleAdd() should fail")
+			}
+			for _, p := range append(tt.kept, ".git/modules/test") {
+				if _, err := os.Stat(filepath.Join(c.opt.DirPath, p)); err != nil {
+					t.Errorf("%s should be kept: %v", p, err)
+				}
+			}
+			for _, p := range []string{outside, filepath.Join(c.opt.DirPath, "dir", "sub"), filepath.Join(c.opt.DirPath, ".git", "modules", "dir")} {
+				if _, err := os.Stat(p); tt.name == "failed_clone_in_existing_dir" && p != outside && !os.IsNotExist(err) {
+					t.Errorf("%s should be cleaned up", p)
+				} else if p == outside && err != nil {
+					t.Errorf("%s should be kept: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleSetURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "ok", path: "test"},
+		{name: "ok_slash", path: "test/"},
+		{name: "ng", path: "none", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockWithSubmodule()
+			if err := c.SubmoduleSetURL(tt.path, "https://example.com/sub.git"); (err != nil) != tt.wantErr {
+				t.Errorf("Client.SubmoduleSetURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, args := range [][]string{
+				{"config", "-f", ".gitmodules", "submodule.test.url"},
+				{"config", "submodule.test.url"},
+				{"-C", "test", "config", "remote.origin.url"},
+			} {
+				out, err := c.gitExec(args)
+				if err != nil || out[0] != "https://example.com/sub.git" {
+					t.Errorf("git %v = %v, %v", args, out, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleSetBranch(t *testing.T) {
+	tests := []struct {
+		name   string
+		branch string
+		want   string
+	}{
+		{name: "ok", branch: "develop", want: "develop"},
+		{name: "ok_default", branch: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockWithSubmodule()
+			if err := c.SubmoduleSetBranch("test", tt.branch); err != nil {
+				t.Errorf("Client.SubmoduleSetBranch() error = %v", err)
+			}
+			out, _ := c.gitExec([]string{"config", "-f", ".gitmodules", "submodule.test.branch"})
+			if out[0] != tt.want {
+				t.Errorf("submodule.test.branch = %v, want %v", out[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleSync(t *testing.T) {
+	c := mockWithSubmodule()
+	c.gitExec([]string{"config", "-f", ".gitmodules", "submodule.test.url", "https://example.com/sub.git"})
+	if err := c.SubmoduleSync(); err != nil {
+		t.Errorf("Client.SubmoduleSync() error = %v", err)
+	}
+	for _, args := range [][]string{
+		{"config", "submodule.test.url"},
+		{"-C", "test", "config", "remote.origin.url"},
+	} {
+		out, err := c.gitExec(args)
+		if err != nil || out[0] != "https://example.com/sub.git" {
+			t.Errorf("git %v = %v, %v", args, out, err)
+		}
+	}
+}
+
+func TestClient_SubmoduleDeinit(t *testing.T) {
+	tests := []struct {
+		name    string
+		dirty   bool
+		wantErr bool
+	}{
+		{name: "ok"},
+		{name: "ng_dirty", dirty: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockWithSubmodule()
+			if tt.dirty {
+				ioutil.WriteFile(filepath.Join(c.opt.DirPath, "test", "file"), []byte("dirty"), 0644)
+			}
+			if err := c.SubmoduleDeinit("test"); (err != nil) != tt.wantErr {
+				t.Errorf("Client.SubmoduleDeinit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			entries, err := ioutil.ReadDir(filepath.Join(c.opt.DirPath, "test"))
+			if err != nil || len(entries) != 0 {
+				t.Errorf("submodule worktree should be empty: %v, %v", entries, err)
+			}
+			if _, err := os.Stat(filepath.Join(c.opt.DirPath, ".git", "modules", "test")); err != nil {
+				t.Errorf(".git/modules/test should be kept: %v", err)
+			}
+			if out, err := c.gitExec([]string{"config", "submodule.test.url"}); err == nil {
+				t.Errorf("submodule.test should be removed from .git/config: %v", out)
+			}
+			if err := c.SubmoduleDeinit("test"); err != nil {
+				t.Errorf("Client.SubmoduleDeinit() twice error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleRemove(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		gitmodules string
+		wantErr    bool
+	}{
+		{name: "ok", target: "test"},
+		{name: "ng", target: "none", wantErr: true},
+		{name: "ng_no_path", target: "x", gitmodules: "[submodule \"x\"]\n\turl = ../x\n", wantErr: true},
+		{name: "ng_parent_path", target: "test", gitmodules: "[submodule \"test\"]\n\tpath = ..\n\turl = ../test\n", wantErr: true},
+		{name: "ng_parent_name", target: "test", gitmodules: "[submodule \"../..\"]\n\tpath = test\n\turl = ../test\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockWithSubmodule()
+			c.Commit("add submodule")
+			if tt.gitmodules != "" {
+				ioutil.WriteFile(filepath.Join(c.opt.DirPath, ".gitmodules"), []byte(tt.gitmodules), 0644)
+			}
+			if err := c.SubmoduleRemove(tt.target); (err != nil) != tt.wantErr {
+				t.Errorf("Client.SubmoduleRemove() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				for _, p := range []string{".git", ".git/modules/test", "test/file", "test2"} {
+					if _, err := os.Stat(filepath.Join(c.opt.DirPath, p)); err != nil {
+						t.Errorf("%s should be kept: %v", p, err)
+					}
+				}
+				return
+			}
+			for _, p := range []string{"test", ".git/modules/test"} {
+				if _, err := os.Stat(filepath.Join(c.opt.DirPath, p)); !os.IsNotExist(err) {
+					t.Errorf("%s should be removed", p)
+				}
+			}
+			b, _ := ioutil.ReadFile(filepath.Join(c.opt.DirPath, ".gitmodules"))
+			if len(b) != 0 {
+				t.Errorf(".gitmodules = %q, want empty", b)
+			}
+			assertion(t, c, map[string][]string{
+				"status": {"M  .gitmodules", "D  test", ""},
+			})
+		})
+	}
+}
+
+func TestClient_SubmoduleUpdate_branch(t *testing.T) {
+	rm, _ := NewMock(MockOpt{
+		CurrentBranch: "master",
+		Branches:      []string{"develop"},
+		Commits:       []MockCommit{{Message: "init", Files: map[string][]byte{"file": {0}}}},
+	})
+	rm.RandomCommitLocal("develop", false)
+	rm.C.Checkout("master", false)
+	hash := func(rev string) string {
+		h, _ := rm.C.r.ResolveRevision(plumbing.Revision(rev))
+		return h.String()
+	}
+	tests := []struct {
+		name     string
+		branch   string
+		override map[string]string
+		want     string
+		wantErr  string
+	}{
+		{name: "gitmodules", branch: "develop", want: hash("develop")},
+		{name: "override", branch: "develop", override: map[string]string{"sub": "master"}, want: hash("master")},
+		{name: "fallback", want: hash("master")},
+		{name: "ng_missing", branch: "nope", wantErr: "remote branch was not found in submodules: sub (nope)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			c.opt.SubmoduleBranches = tt.override
+			if err := c.SubmoduleAdd("sub", rm.C.opt.DirPath, "master", nil); err != nil {
+				t.Fatal(err)
+			}
+			c.SubmoduleSetBranch("sub", tt.branch)
+			err := c.SubmoduleUpdate(true)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Client.SubmoduleUpdate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Client.SubmoduleUpdate() error = %v", err)
+			}
+			out, _ := c.gitExec([]string{"-C", "sub", "rev-parse", "HEAD"})
+			if out[0] != tt.want {
+				t.Errorf("submodule HEAD = %v, want %v", out[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleUpdateWith(t *testing.T) {
+	sub := mockWithRemote()
+	tests := []struct {
+		name        string
+		opt         SubmoduleUpdateOpt
+		wantSkipped []string
+		wantErr     string
+	}{
+		{
+			name:    "parallel",
+			opt:     SubmoduleUpdateOpt{Remote: true, Concurrency: 2},
+			wantErr: "remote branch was not found in submodules: a (nope)",
+		},
+		{
+			name:        "fail_fast",
+			opt:         SubmoduleUpdateOpt{Remote: true, FailFast: true},
+			wantSkipped: []string{"b", "c"},
+			wantErr:     "remote branch was not found in submodules: a (nope)",
+		},
+		{
+			name: "local",
+			opt:  SubmoduleUpdateOpt{Concurrency: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockInit()
+			for _, name := range []string{"c", "a", "b"} {
+				if err := c.SubmoduleAdd(name, sub.opt.OriginURL, "master", nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.SubmoduleSetBranch("a", "nope")
+			report, err := c.SubmoduleUpdateWith(tt.opt)
+			if err != nil {
+				t.Fatalf("Client.SubmoduleUpdateWith() error = %v", err)
+			}
+			skipped := []string{}
+			for i, res := range report.Results {
+				if res.Path != []string{"a", "b", "c"}[i] {
+					t.Errorf("results are not sorted: %v", report.Results)
+				}
+				if res.Skipped {
+					skipped = append(skipped, res.Name)
+				} else if res.Err == nil && res.Hash == "" {
+					t.Errorf("hash of %s is empty", res.Name)
+				}
+			}
+			if diff := cmp.Diff(tt.wantSkipped, skipped, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("skipped mismatch (-want +got):\n%s", diff)
+			}
+			got := ""
+			if err := report.Err(); err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("SubmoduleReport.Err() = %v, want %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mockWithNestedSubmodule() Client {
+	leaf := mockWithRemote()
+	mid := mockInit()
+	if err := mid.SubmoduleAdd("leaf", leaf.opt.OriginURL, "master", nil); err != nil {
+		panic(err)
+	}
+	mid.Commit("add leaf")
+	c := mockInit()
+	if err := c.SubmoduleAdd("mid", mid.opt.DirPath, "master", nil); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestClient_SubmoduleUpdateWith_nested(t *testing.T) {
+	tests := []struct {
+		name       string
+		opt        SubmoduleUpdateOpt
+		wantNested bool
+	}{
+		{name: "first_level", opt: SubmoduleUpdateOpt{}},
+		{name: "recursive", opt: SubmoduleUpdateOpt{Depth: -1}, wantNested: true},
+		{name: "recursive_remote", opt: SubmoduleUpdateOpt{Remote: true, Depth: 1, Concurrency: 2}, wantNested: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockWithNestedSubmodule()
+			report, err := c.SubmoduleUpdateWith(tt.opt)
+			if err != nil || report.Err() != nil {
+				t.Fatalf("Client.SubmoduleUpdateWith() error = %v, %v", err, report.Err())
+			}
+			_, err = os.Stat(filepath.Join(c.opt.DirPath, "mid", "leaf", "file"))
+			if (err == nil) != tt.wantNested {
+				t.Errorf("nested submodule checkout = %v, want %v", err == nil, tt.wantNested)
+			}
+			mid := report.Results[0]
+			if !tt.wantNested {
+				if len(mid.Submodules) != 0 {
+					t.Errorf("nested results should be empty: %v", mid.Submodules)
+				}
+				return
+			}
+			info, _ := c.Info()
+			for path := range info.Submodules["mid"].Submodules {
+				if mid.Submodules[path].Hash != info.Submodules["mid"].Submodules[path].Current {
+					t.Errorf("nested result of %s = %v, want %v", path, mid.Submodules[path], info.Submodules["mid"].Submodules[path].Current)
+				}
+			}
+			if len(mid.Submodules) != 1 || len(info.Submodules["mid"].Submodules) != 1 {
+				t.Errorf("nested results = %v, info = %v", mid.Submodules, info.Submodules["mid"].Submodules)
+			}
+		})
+	}
+}
+
+func TestClient_SubmoduleSyncUpToDateWith(t *testing.T) {
+	tests := []struct {
+		name       string
+		opt        SubmoduleSyncOpt
+		wantBranch string
+	}{
+		{name: "dry_run", opt: SubmoduleSyncOpt{DryRun: true}, wantBranch: "master"},
+		{name: "current_branch", opt: SubmoduleSyncOpt{}, wantBranch: "master"},
+		{name: "separate_branch", opt: SubmoduleSyncOpt{Message: "bump", Branch: "bump"}, wantBranch: "bump"},
+		{name: "separate_branch_push_error", opt: SubmoduleSyncOpt{Message: "bump", Branch: "bump"}, wantBranch: "master"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewMock(MockOpt{
+				CurrentBranch: "master",
+				Commits:       []MockCommit{{Message: "init", Files: map[string][]byte{"file": {0}}}},
+			})
+			c := mockWithSubmodule()
+			c.SubmoduleAdd("sub", m.C.opt.DirPath, "master", nil)
+			c.Commit("add submodules")
+			c.Push()
+			from, _ := m.C.r.Head()
+			m.C.CommitFiles(map[string][]byte{"a": {1}}, "feat: a")
+			m.C.CommitFiles(map[string][]byte{"b": {1}}, "fix: b\n\nbody")
+			to, _ := m.C.r.Head()
+			ioutil.WriteFile(filepath.Join(c.opt.DirPath, "untracked"), []byte{0}, 0644)
+			c.addFile("unrelated", []byte{1})
+			c.Add("unrelated")
+			if tt.name == "separate_branch_push_error" {
+				c.gitExec([]string{"remote", "set-url", "origin", filepath.Join(c.opt.DirPath, "missing")})
+				if _, err := c.SubmoduleSyncUpToDateWith(tt.opt); err == nil {
+					t.Fatal("Client.SubmoduleSyncUpToDateWith() should fail to push")
+				}
+				assertion(t, c, map[string][]string{
+					"branch":              {"master", ""},
+					"status":              {" M sub", "A  unrelated", "?? untracked", ""},
+					"latestCommitMessage": {"add submodules", ""},
+				})
+				if _, err := c.r.Reference(plumbing.NewBranchReferenceName("bump"), false); err == nil {
+					t.Error("the bump branch should be removed after a failed push")
+				}
+				return
+			}
+
+			got, err := c.SubmoduleSyncUpToDateWith(tt.opt)
+			if err != nil {
+				t.Fatalf("Client.SubmoduleSyncUpToDateWith() error = %v", err)
+			}
+			want := []SubmoduleBump{{
+				Name:     "sub",
+				Path:     "sub",
+				From:     from.Hash().String(),
+				To:       to.Hash().String(),
+				Subjects: []string{"fix: b", "feat: a"},
+			}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Client.SubmoduleSyncUpToDateWith() mismatch (-want +got):\n%s", diff)
+			}
+			remote := Client{opt: ClientOpt{DirPath: c.opt.OriginURL}}
+			remote.r, _ = git.PlainOpen(c.opt.OriginURL)
+			out, _ := remote.gitExec([]string{"log", "-1", "--pretty=%B", tt.wantBranch})
+			message := []string{
+				"bump", "",
+				fmt.Sprintf("* sub: %s..%s", from.Hash().String()[:7], to.Hash().String()[:7]),
+				"  - fix: b", "  - feat: a", "", "",
+			}
+			switch tt.name {
+			case "dry_run":
+				message = []string{"add submodules", ""}
+			case "current_branch":
+				message[0] = "Bump submodules"
+			}
+			if diff := cmp.Diff(message, out); diff != "" {
+				t.Errorf("pushed message mismatch (-want +got):\n%s", diff)
+			}
+			if out, _ := remote.gitExec([]string{"show", "--name-only", "--format=", tt.wantBranch}); tt.name != "dry_run" && !reflect.DeepEqual(out, []string{"sub", ""}) {
+				t.Errorf("pushed commit changed %v, want only sub", out)
+			}
+			status := []string{"A  unrelated", "?? untracked", ""}
+			if tt.name == "separate_branch" {
+				status = []string{" M sub", "A  unrelated", "?? untracked", ""}
+			}
+			assertion(t, c, map[string][]string{"branch": {"master", ""}, "status": status})
+		})
+	}
+}
+
+func TestClient_SubmoduleStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c Client)
+		want   func(recorded, remote string) SubmoduleState
+	}{
+		{
+			name:   "behind",
+			modify: func(c Client) {},
+			want: func(recorded, remote string) SubmoduleState {
+				return SubmoduleState{Current: recorded, Initialized: true, Divergence: Divergence{MergeBase: recorded, Behind: 2}}
+			},
+		},
+		{
+			name: "modified",
+			modify: func(c Client) {
+				c.SubmoduleUpdate(true)
+				ioutil.WriteFile(filepath.Join(c.opt.DirPath, "sub", "file"), []byte{1}, 0644)
+			},
+			want: func(recorded, remote string) SubmoduleState {
+				return SubmoduleState{Current: remote, Initialized: true, Modified: true, Dirty: true, Divergence: Divergence{MergeBase: recorded, Behind: 2}}
+			},
+		},
+		{
+			name: "uninitialized",
+			modify: func(c Client) {
+				c.SubmoduleDeinit("sub")
+			},
+			want: func(recorded, remote string) SubmoduleState {
+				return SubmoduleState{}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewMock(MockOpt{
+				CurrentBranch: "master",
+				Commits:       []MockCommit{{Message: "init", Files: map[string][]byte{"file": {0}}}},
+			})
+			c := mockInit()
+			c.SubmoduleAdd("sub", m.C.opt.DirPath, "master", nil)
+			c.Commit("add submodule")
+			recorded, _ := m.C.r.Head()
+			m.C.CommitFiles(map[string][]byte{"a": {1}}, "a")
+			m.C.CommitFiles(map[string][]byte{"b": {1}}, "b")
+			remote, _ := m.C.r.Head()
+			tt.modify(c)
+
+			got, err := c.SubmoduleStatus()
+			if err != nil {
+				t.Fatalf("Client.SubmoduleStatus() error = %v", err)
+			}
+			want := tt.want(recorded.Hash().String(), remote.Hash().String())
+			want.Name, want.Path, want.Branch, want.Recorded = "sub", "sub", "master", recorded.Hash().String()
+			if want.Initialized {
+				want.Remote, want.Upstream = remote.Hash().String(), "origin/master"
+			}
+			if diff := cmp.Diff([]SubmoduleState{want}, got); diff != "" {
+				t.Errorf("Client.SubmoduleStatus() mismatch (-want +got):\n%s", diff)
+			}
+			out, _ := c.gitExec([]string{"submodule", "status"})
+			prefix := " "
+			if !got[0].Initialized {
+				prefix = "-"
+			} else if got[0].Modified {
+				prefix = "+"
+			}
+			if !strings.HasPrefix(out[0], prefix+got[0].Current) && !strings.HasPrefix(out[0], prefix+got[0].Recorded) {
+				t.Errorf("git submodule status = %v", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,518 @@
+package gtc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pkg/errors"
+)
+
+const (
+	subtreeRemoteName = "subtree"
+	subtreeFetchRef   = plumbing.ReferenceName("refs/subtree/fetch")
+	subtreeSplitRef   = plumbing.ReferenceName("refs/subtree/split")
+)
+
+// SubtreeAdd merges the history of rev in url into prefix like git subtree add.
+func (c *Client) SubtreeAdd(prefix, url, rev string, auth *AuthMethod) error {
+	prefix = cleanPath(prefix)
+	head, err := c.subtreePrecondition()
+	if err != nil {
+		return err
+	}
+	if _, err := subtreeHash(head, prefix); err == nil {
+		return errors.Errorf("prefix %s already exists", prefix)
+	}
+	fetched, err := c.subtreeFetch(url, rev, auth)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Add '%s/' from commit '%s'\n\ngit-subtree-dir: %s\ngit-subtree-mainline: %s\ngit-subtree-split: %s\n",
+		prefix, fetched.Hash, prefix, head.Hash, fetched.Hash)
+	return c.subtreeMerge(head, fetched, prefix, fetched.TreeHash, message)
+}
+
+// SubtreePull merges rev in url into prefix like git subtree pull. When prefix has local
+// commits which rev lacks, both sides are merged file by file with their last common split
+// commit as the base. A file changed differently on both sides is a conflict and nothing is
+// committed; git merges the contents of such files instead.
+func (c *Client) SubtreePull(prefix, url, rev string, auth *AuthMethod) error {
+	prefix = cleanPath(prefix)
+	head, err := c.subtreePrecondition()
+	if err != nil {
+		return err
+	}
+	split, err := c.subtreeSplit(head, prefix)
+	if err != nil {
+		return err
+	}
+	fetched, err := c.subtreeFetch(url, rev, auth)
+	if err != nil {
+		return err
+	}
+	if split.Hash == fetched.Hash {
+		return nil
+	}
+	if ok, err := fetched.IsAncestor(split); err != nil || ok {
+		return err
+	}
+	message := fmt.Sprintf("Merge commit '%s'\n", fetched.Hash)
+	if ok, err := split.IsAncestor(fetched); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		return c.subtreeMerge(head, fetched, prefix, fetched.TreeHash, message)
+	}
+	bases, err := split.MergeBase(fetched)
+	if err != nil {
+		return err
+	}
+	if len(bases) == 0 {
+		return errors.Errorf("%s and %s of %s have no common history", prefix, rev, url)
+	}
+	tree, err := c.mergeTrees(bases[0], split, fetched)
+	if err != nil {
+		return errors.Wrapf(err, "failed to merge %s of %s into %s", rev, url, prefix)
+	}
+	return c.subtreeMerge(head, fetched, prefix, tree, message)
+}
+
+// SubtreePush splits prefix and pushes the result to rev in url.
+func (c *Client) SubtreePush(prefix, url, rev string, auth *AuthMethod) error {
+	h, err := c.SubtreeSplit(prefix)
+	if err != nil {
+		return err
+	}
+	if err := c.r.Storer.SetReference(plumbing.NewHashReference(subtreeSplitRef, plumbing.NewHash(h))); err != nil {
+		return err
+	}
+	defer c.r.Storer.RemoveReference(subtreeSplitRef)
+	remote := git.NewRemote(c.r.Storer, &config.RemoteConfig{Name: subtreeRemoteName, URLs: []string{url}})
+	spec := config.RefSpec(fmt.Sprintf("%s:%s", subtreeSplitRef, subtreeRevisionName(rev)))
+	if err := remote.Push(&git.PushOptions{
+		RemoteName: subtreeRemoteName,
+		Auth:       subtreeAuth(auth),
+		RefSpecs:   []config.RefSpec{spec},
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return errors.Wrapf(err, "failed to push %s to %s", prefix, url)
+	}
+	return nil
+}
+
+// SubtreeSplit synthesizes the history of prefix like git subtree split and returns its head.
+// Upstream commits merged by SubtreeAdd and SubtreePull are reused as they are.
+func (c *Client) SubtreeSplit(prefix string) (string, error) {
+	head, err := c.resolveCommit("HEAD")
+	if err != nil {
+		return "", err
+	}
+	split, err := c.subtreeSplit(head, cleanPath(prefix))
+	if err != nil {
+		return "", err
+	}
+	return split.Hash.String(), nil
+}
+
+func (c *Client) AddClientAsSubtree(prefix string, subc Client) error {
+	return c.SubtreeAdd(prefix, subc.opt.OriginURL, subc.opt.Revision, &subc.opt.Auth)
+}
+
+func (c *Client) subtreePrecondition() (*object.Commit, error) {
+	clean, err := c.IsCleanWith(CleanOpt{IgnoreUntracked: true})
+	if err != nil {
+		return nil, err
+	}
+	if !clean {
+		return nil, errors.New("working tree has modifications")
+	}
+	return c.resolveCommit("HEAD")
+}
+
+func (c *Client) subtreeFetch(url, rev string, auth *AuthMethod) (*object.Commit, error) {
+	remote := git.NewRemote(c.r.Storer, &config.RemoteConfig{Name: subtreeRemoteName, URLs: []string{url}})
+	spec := config.RefSpec(fmt.Sprintf("+%s:%s", subtreeRevisionName(rev), subtreeFetchRef))
+	defer c.r.Storer.RemoveReference(subtreeFetchRef)
+	if err := remote.Fetch(&git.FetchOptions{
+		RemoteName: subtreeRemoteName,
+		RefSpecs:   []config.RefSpec{spec},
+		Auth:       subtreeAuth(auth),
+		Tags:       git.NoTags,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, errors.Wrapf(err, "failed to fetch %s of %s", rev, url)
+	}
+	ref, err := c.r.Reference(subtreeFetchRef, true)
+	if err != nil {
+		return nil, err
+	}
+	return c.r.CommitObject(ref.Hash())
+}
+
+// subtreeMerge commits a merge of fetched with prefix set to merged and checks it out.
+func (c *Client) subtreeMerge(head, fetched *object.Commit, prefix string, merged plumbing.Hash, message string) error {
+	root, err := head.Tree()
+	if err != nil {
+		return err
+	}
+	tree, err := c.replaceSubtree(root, strings.Split(prefix, "/"), merged)
+	if err != nil {
+		return err
+	}
+	sig := object.Signature{Name: c.opt.AuthorName, Email: c.opt.AuthorEmail, When: time.Now()}
+	h, err := c.storeCommit(&object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{head.Hash, fetched.Hash},
+	})
+	if err != nil {
+		return err
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{Commit: h, Mode: git.MergeReset})
+}
+
+// subtreeSplit rewrites every commit touching prefix, parents first.
+func (c *Client) subtreeSplit(head *object.Commit, prefix string) (*object.Commit, error) {
+	// upstream commits merged by SubtreeAdd map to themselves
+	mapped := map[plumbing.Hash]plumbing.Hash{}
+	err := object.NewCommitPreorderIter(head, nil, nil).ForEach(func(commit *object.Commit) error {
+		split := subtreeTrailer(commit, prefix)
+		if _, ok := mapped[split]; ok || split.IsZero() {
+			return nil
+		}
+		upstream, err := c.r.CommitObject(split)
+		if err != nil {
+			return err
+		}
+		return object.NewCommitPreorderIter(upstream, nil, nil).ForEach(func(u *object.Commit) error {
+			mapped[u.Hash] = u.Hash
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	order, err := topoOrder(head, mapped)
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range order {
+		parents := []plumbing.Hash{}
+		for _, p := range commit.ParentHashes {
+			if m, ok := mapped[p]; ok && !containsHash(parents, m) {
+				parents = append(parents, m)
+			}
+		}
+		tree, err := subtreeHash(commit, prefix)
+		if err != nil {
+			// like git subtree, a commit without prefix on top of split commits is an
+			// upstream one merged by SubtreePull
+			if len(parents) > 0 {
+				mapped[commit.Hash] = commit.Hash
+			}
+			continue
+		}
+		identical, err := c.identicalParent(parents, tree)
+		if err != nil {
+			return nil, err
+		}
+		if !identical.IsZero() {
+			mapped[commit.Hash] = identical
+			continue
+		}
+		h, err := c.storeCommit(&object.Commit{
+			Author:       commit.Author,
+			Committer:    commit.Committer,
+			Message:      commit.Message,
+			TreeHash:     tree,
+			ParentHashes: parents,
+		})
+		if err != nil {
+			return nil, err
+		}
+		mapped[commit.Hash] = h
+	}
+	h, ok := mapped[head.Hash]
+	if !ok {
+		return nil, errors.Errorf("no commits were found under %s", prefix)
+	}
+	return c.r.CommitObject(h)
+}
+
+// identicalParent returns the parent which can replace a commit with tree as git subtree does:
+// its tree is the same and the other parents add no history to it.
+func (c *Client) identicalParent(parents []plumbing.Hash, tree plumbing.Hash) (plumbing.Hash, error) {
+	var identical, nonidentical *object.Commit
+	for _, h := range parents {
+		p, err := c.r.CommitObject(h)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if p.TreeHash != tree {
+			nonidentical = p
+			continue
+		}
+		if identical == nil {
+			identical = p
+			continue
+		}
+		bases, err := identical.MergeBase(p)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		switch {
+		case len(bases) > 0 && bases[0].Hash == identical.Hash:
+			identical = p
+		case len(bases) == 0 || bases[0].Hash != p.Hash:
+			return plumbing.ZeroHash, nil
+		}
+	}
+	if identical == nil {
+		return plumbing.ZeroHash, nil
+	}
+	if nonidentical != nil {
+		if ok, err := nonidentical.IsAncestor(identical); err != nil || !ok {
+			return plumbing.ZeroHash, err
+		}
+	}
+	return identical.Hash, nil
+}
+
+// topoOrder lists the ancestors of head with parents first, stopping at done commits.
+func topoOrder(head *object.Commit, done map[plumbing.Hash]plumbing.Hash) ([]*object.Commit, error) {
+	ret := []*object.Commit{}
+	visited := map[plumbing.Hash]bool{}
+	type frame struct {
+		commit   *object.Commit
+		expanded bool
+	}
+	stack := []frame{{commit: head}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.expanded {
+			ret = append(ret, f.commit)
+			continue
+		}
+		if _, ok := done[f.commit.Hash]; ok || visited[f.commit.Hash] {
+			continue
+		}
+		visited[f.commit.Hash] = true
+		stack = append(stack, frame{commit: f.commit, expanded: true})
+		for i := f.commit.NumParents() - 1; i >= 0; i-- {
+			p, err := f.commit.Parent(i)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, frame{commit: p})
+		}
+	}
+	return ret, nil
+}
+
+// replaceSubtree stores a copy of root with the tree at path set to sub.
+func (c *Client) replaceSubtree(root *object.Tree, path []string, sub plumbing.Hash) (plumbing.Hash, error) {
+	return c.setTreeEntry(root, path, filemode.Dir, sub)
+}
+
+// setTreeEntry stores a copy of root with the entry at path set to mode and hash.
+func (c *Client) setTreeEntry(root *object.Tree, path []string, mode filemode.FileMode, hash plumbing.Hash) (plumbing.Hash, error) {
+	entries := []object.TreeEntry{}
+	found := false
+	for _, e := range root.Entries {
+		if e.Name != path[0] {
+			entries = append(entries, e)
+			continue
+		}
+		found = true
+		if len(path) == 1 {
+			entries = append(entries, object.TreeEntry{Name: e.Name, Mode: mode, Hash: hash})
+			continue
+		}
+		child, err := root.Tree(e.Name)
+		if err != nil {
+			return plumbing.ZeroHash, errors.Wrapf(err, "%s is not a directory", e.Name)
+		}
+		h, err := c.setTreeEntry(child, path[1:], mode, hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: e.Name, Mode: filemode.Dir, Hash: h})
+	}
+	if !found {
+		m, h := mode, hash
+		if len(path) > 1 {
+			var err error
+			if h, err = c.setTreeEntry(&object.Tree{}, path[1:], mode, hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+			m = filemode.Dir
+		}
+		entries = append(entries, object.TreeEntry{Name: path[0], Mode: m, Hash: h})
+	}
+	return c.storeTree(entries)
+}
+
+// mergeTrees applies the changes from base to theirs onto ours file by file and stores
+// the result. Files changed differently on both sides are reported as conflicts.
+func (c *Client) mergeTrees(base, ours, theirs *object.Commit) (plumbing.Hash, error) {
+	files := [3]map[string]*diffEntry{}
+	for i, commit := range []*object.Commit{base, ours, theirs} {
+		tree, err := commit.Tree()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if files[i], err = c.treeEntries(tree); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	same := func(a, b *diffEntry) bool {
+		return a == nil && b == nil || a != nil && b != nil && a.hash == b.hash && a.mode == b.mode
+	}
+	paths := map[string]bool{}
+	for _, side := range files {
+		for p := range side {
+			paths[p] = true
+		}
+	}
+	merged, conflicts := map[string]*diffEntry{}, []string{}
+	for p := range paths {
+		b, o, t := files[0][p], files[1][p], files[2][p]
+		switch {
+		case same(o, t), same(b, t):
+			merged[p] = o
+		case same(b, o):
+			merged[p] = t
+		default:
+			conflicts = append(conflicts, p)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return plumbing.ZeroHash, errors.Errorf("conflicts in %s", strings.Join(conflicts, ", "))
+	}
+	return c.writeTree(merged)
+}
+
+// writeTree stores the tree holding files, which are keyed by slash separated paths.
+// Nil entries are left out.
+func (c *Client) writeTree(files map[string]*diffEntry) (plumbing.Hash, error) {
+	entries := []object.TreeEntry{}
+	dirs := map[string]map[string]*diffEntry{}
+	for p, e := range files {
+		if e == nil {
+			continue
+		}
+		if i := strings.Index(p, "/"); i >= 0 {
+			if dirs[p[:i]] == nil {
+				dirs[p[:i]] = map[string]*diffEntry{}
+			}
+			dirs[p[:i]][p[i+1:]] = e
+			continue
+		}
+		entries = append(entries, object.TreeEntry{Name: p, Mode: e.mode, Hash: e.hash})
+	}
+	for name, sub := range dirs {
+		if files[name] != nil {
+			return plumbing.ZeroHash, errors.Errorf("conflicts in %s", name)
+		}
+		h, err := c.writeTree(sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+	return c.storeTree(entries)
+}
+
+// storeTree sorts entries like git and stores them as a tree.
+func (c *Client) storeTree(entries []object.TreeEntry) (plumbing.Hash, error) {
+	// git sorts directories as if they had a trailing slash
+	sortKey := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool { return sortKey(entries[i]) < sortKey(entries[j]) })
+	obj := c.r.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return c.r.Storer.SetEncodedObject(obj)
+}
+
+func (c *Client) storeCommit(commit *object.Commit) (plumbing.Hash, error) {
+	obj := c.r.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return c.r.Storer.SetEncodedObject(obj)
+}
+
+func subtreeHash(commit *object.Commit, prefix string) (plumbing.Hash, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	e, err := tree.FindEntry(prefix)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if e.Mode != filemode.Dir {
+		return plumbing.ZeroHash, errors.Errorf("%s is not a directory", prefix)
+	}
+	return e.Hash, nil
+}
+
+// subtreeTrailer returns git-subtree-split of commits made by SubtreeAdd for prefix.
+func subtreeTrailer(commit *object.Commit, prefix string) plumbing.Hash {
+	dir, split := "", ""
+	for _, t := range parseTrailers(commit.Message) {
+		switch t.Key {
+		case "git-subtree-dir":
+			dir = t.Value
+		case "git-subtree-split":
+			split = t.Value
+		}
+	}
+	if cleanPath(dir) != prefix || !plumbing.IsHash(split) {
+		return plumbing.ZeroHash
+	}
+	return plumbing.NewHash(split)
+}
+
+func subtreeRevisionName(rev string) plumbing.ReferenceName {
+	if strings.HasPrefix(rev, "refs/") {
+		return plumbing.ReferenceName(rev)
+	}
+	return plumbing.NewBranchReferenceName(rev)
+}
+
+func subtreeAuth(auth *AuthMethod) transport.AuthMethod {
+	if auth == nil {
+		return nil
+	}
+	return auth.AuthMethod
+}
+
+func containsHash(hashes []plumbing.Hash, h plumbing.Hash) bool {
+	for _, x := range hashes {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package gtc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mockWithSubtree() (Client, Mock) {
+	m, err := NewMock(MockOpt{
+		CurrentBranch: "master",
+		Commits: []MockCommit{
+			{Message: "init", Files: map[string][]byte{"file": {0}}},
+			{Message: "second", Files: map[string][]byte{"dir/file": {1}}},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	c := mockWithRemote()
+	if err := c.SubtreeAdd("vendor/lib", m.C.opt.DirPath, "master", nil); err != nil {
+		panic(err)
+	}
+	return c, m
+}
+
+func TestClient_SubtreeAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		dirty   bool
+		wantErr bool
+	}{
+		{name: "ok", prefix: "other"},
+		{name: "ng_exists", prefix: "vendor/lib", wantErr: true},
+		{name: "ng_dirty", prefix: "other", dirty: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, m := mockWithSubtree()
+			if tt.dirty {
+				os.WriteFile(filepath.Join(c.opt.DirPath, "file"), []byte("dirty"), 0644)
+			}
+			if err := c.SubtreeAdd(tt.prefix, m.C.opt.DirPath, "master", nil); (err != nil) != tt.wantErr {
+				t.Errorf("Client.SubtreeAdd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			upstream, _ := m.C.r.Head()
+			for _, p := range []string{"vendor/lib/file", "vendor/lib/dir/file", "other/dir/file"} {
+				if _, err := os.Stat(filepath.Join(c.opt.DirPath, p)); err != nil {
+					t.Errorf("%s should exist: %v", p, err)
+				}
+			}
+			assertion(t, c, map[string][]string{
+				"status":              {""},
+				"latestCommitMessage": {"Add 'other/' from commit '" + upstream.Hash().String() + "'", "", "git-subtree-dir: other", "git-subtree-mainline: " + c.mustHash("HEAD^1"), "git-subtree-split: " + upstream.Hash().String(), "", ""},
+			})
+			if out, err := c.gitExec([]string{"fsck", "--strict"}); err != nil {
+				t.Errorf("git fsck: %v", out)
+			}
+		})
+	}
+}
+
+func TestClient_SubtreeSplit(t *testing.T) {
+	c, m := mockWithSubtree()
+	upstream, _ := m.C.r.Head()
+	got, err := c.SubtreeSplit("vendor/lib")
+	if err != nil || got != upstream.Hash().String() {
+		t.Errorf("Client.SubtreeSplit() = %v, %v, want %v", got, err, upstream.Hash())
+	}
+	c.CommitFiles(map[string][]byte{"vendor/lib/local": {2}, "file": {3}}, "local change")
+	c.CommitFiles(map[string][]byte{"file": {4}}, "outside change")
+	got, err = c.SubtreeSplit("vendor/lib/")
+	if err != nil {
+		t.Fatalf("Client.SubtreeSplit() error = %v", err)
+	}
+	out, err := c.gitExec([]string{"subtree", "split", "-q", "--prefix=vendor/lib"})
+	if err != nil {
+		t.Fatalf("git subtree split: %v", out)
+	}
+	if got != out[0] {
+		t.Errorf("Client.SubtreeSplit() = %v, git subtree split = %v", got, out)
+	}
+	if _, err := c.SubtreeSplit("none"); err == nil {
+		t.Errorf("Client.SubtreeSplit() should fail for unknown prefixes")
+	}
+}
+
+func TestClient_SubtreePushPull(t *testing.T) {
+	c, m := mockWithSubtree()
+	c.CommitFiles(map[string][]byte{"vendor/lib/local": {2}}, "local change")
+	if err := c.SubtreePush("vendor/lib", m.C.opt.DirPath, "split", nil); err != nil {
+		t.Fatalf("Client.SubtreePush() error = %v", err)
+	}
+	split, _ := c.SubtreeSplit("vendor/lib")
+	if got := m.C.mustHash("split"); got != split {
+		t.Errorf("pushed split = %v, want %v", got, split)
+	}
+	if err := c.SubtreePull("vendor/lib", m.C.opt.DirPath, "split", nil); err != nil {
+		t.Errorf("Client.SubtreePull() up to date error = %v", err)
+	}
+	m.C.Checkout("split", false)
+	m.C.CommitFiles(map[string][]byte{"upstream": {5}}, "upstream change")
+	if err := c.SubtreePull("vendor/lib", m.C.opt.DirPath, "split", nil); err != nil {
+		t.Fatalf("Client.SubtreePull() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.opt.DirPath, "vendor/lib/upstream")); err != nil {
+		t.Errorf("pulled file should exist: %v", err)
+	}
+	assertion(t, c, map[string][]string{
+		"status":              {""},
+		"latestCommitMessage": {"Merge commit '" + m.C.mustHash("split") + "'", "", ""},
+	})
+	if got, _ := c.SubtreeSplit("vendor/lib"); got != m.C.mustHash("split") {
+		t.Errorf("split after pull = %v, want %v", got, m.C.mustHash("split"))
+	}
+	if out, _ := c.gitExec([]string{"subtree", "split", "-q", "--prefix=vendor/lib"}); out[0] != m.C.mustHash("split") {
+		t.Errorf("git subtree split after pull = %v, want %v", out, m.C.mustHash("split"))
+	}
+
+	// local patches which upstream lacks are merged like git subtree pull
+	c.CommitFiles(map[string][]byte{"vendor/lib/unpushed": {6}}, "unpushed change")
+	m.C.CommitFiles(map[string][]byte{"upstream2": {7}}, "upstream change 2")
+	opt := mockOpt()
+	if out, err := c.gitExec([]string{"clone", "-q", c.opt.DirPath, opt.DirPath}); err != nil {
+		t.Fatalf("git clone: %v", out)
+	}
+	oracle, _ := Open(opt)
+	if out, err := oracle.gitExec([]string{"-c", "user.name=bob", "-c", "user.email=bob@mail.com", "subtree", "pull", "-q", "--prefix=vendor/lib", m.C.opt.DirPath, "split", "-m", "merge"}); err != nil {
+		t.Fatalf("git subtree pull: %v", out)
+	}
+	if err := c.SubtreePull("vendor/lib", m.C.opt.DirPath, "split", nil); err != nil {
+		t.Fatalf("Client.SubtreePull() with local changes error = %v", err)
+	}
+	if got, want := gitRevParse(t, c, "HEAD:vendor/lib"), gitRevParse(t, oracle, "HEAD:vendor/lib"); got != want {
+		t.Errorf("merged vendor/lib = %v, want %v like git subtree pull", got, want)
+	}
+	assertion(t, c, map[string][]string{
+		"status":              {""},
+		"latestCommitMessage": {"Merge commit '" + m.C.mustHash("split") + "'", "", ""},
+	})
+	split, _ = c.SubtreeSplit("vendor/lib")
+	if out, _ := c.gitExec([]string{"subtree", "split", "-q", "--prefix=vendor/lib"}); out[0] != split {
+		t.Errorf("git subtree split after merge = %v, want %v", out, split)
+	}
+
+	head := c.mustHash("HEAD")
+	c.CommitFiles(map[string][]byte{"vendor/lib/upstream": {8}}, "local edit")
+	m.C.CommitFiles(map[string][]byte{"upstream": {9}}, "upstream edit")
+	if err := c.SubtreePull("vendor/lib", m.C.opt.DirPath, "split", nil); err == nil || !strings.Contains(err.Error(), "conflicts in upstream") {
+		t.Errorf("Client.SubtreePull() should fail with a conflict: %v", err)
+	}
+	if got := c.mustHash("HEAD~1"); got != head {
+		t.Errorf("HEAD~1 = %v, want %v after a conflict", got, head)
+	}
+}
@@ -0,0 +1,369 @@
+package gtc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+type TagStrategy string
+
+const (
+	// TagStrategyCommitDate picks the tag whose commit has the newest author date.
+	TagStrategyCommitDate TagStrategy = "commit-date"
+	// TagStrategySemver picks the highest semantic version.
+	TagStrategySemver TagStrategy = "semver"
+	// TagStrategyTaggerDate picks the newest annotated tag by tagger date.
+	// Lightweight tags use the committer date of their commit.
+	TagStrategyTaggerDate TagStrategy = "tagger-date"
+	// TagStrategyNearest picks the tag reachable from From with the fewest commits in between.
+	TagStrategyNearest TagStrategy = "nearest"
+)
+
+type LatestTagOpt struct {
+	Strategy    TagStrategy
+	ReferRemote bool
+	// Prefix is stripped before parsing versions, e.g. "v". Tags without it are ignored by semver.
+	Prefix            string
+	IncludePrerelease bool
+	// Constraint limits semver tags, e.g. ">=1.2 <2".
+	Constraint string
+	// From is the starting revision of TagStrategyNearest. Empty means HEAD.
+	From string
+}
+
+type tagCandidate struct {
+	ref     *plumbing.Reference
+	commit  *object.Commit
+	date    time.Time
+	version *Version
+}
+
+// GetLatestTagReferenceWith selects the latest tag with the given strategy.
+func (c *Client) GetLatestTagReferenceWith(opt LatestTagOpt) (*plumbing.Reference, error) {
+	if opt.ReferRemote {
+		if err := c.checkoutRemoteRevision(); err != nil {
+			return nil, err
+		}
+	}
+	candidates, err := c.tagCandidates(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no tag was found")
+	}
+	switch opt.Strategy {
+	case TagStrategySemver:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].version.Compare(*candidates[j].version) > 0
+		})
+	case TagStrategyNearest:
+		return c.nearestTag(opt.From, candidates)
+	case TagStrategyCommitDate, TagStrategyTaggerDate, "":
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].date.After(candidates[j].date)
+		})
+	default:
+		return nil, errors.Errorf("unknown tag strategy %s", opt.Strategy)
+	}
+	return candidates[0].ref, nil
+}
+
+func (c *Client) checkoutRemoteRevision() error {
+	if err := c.Fetch(); err != nil {
+		return errors.Wrap(err, "failed to fetch")
+	}
+	w, err := c.r.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewRemoteReferenceName("origin", c.opt.Revision), Force: true}); err != nil {
+		return errors.Wrap(err, "failed to checkout remote branch")
+	}
+	return nil
+}
+
+// tagCandidates lists tags pointing at commits, sorted by name so that ties are stable.
+func (c *Client) tagCandidates(opt LatestTagOpt) ([]tagCandidate, error) {
+	var constraint *Constraint
+	if opt.Constraint != "" {
+		parsed, err := ParseConstraint(opt.Constraint)
+		if err != nil {
+			return nil, err
+		}
+		constraint = &parsed
+	}
+	tags, err := c.r.Tags()
+	if err != nil {
+		return nil, err
+	}
+	ret := []tagCandidate{}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		cand := tagCandidate{ref: ref}
+		tag, err := c.r.TagObject(ref.Hash())
+		switch err {
+		case nil:
+			if cand.commit, err = tag.Commit(); err == object.ErrUnsupportedObject {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		case plumbing.ErrObjectNotFound:
+			if cand.commit, err = c.r.CommitObject(ref.Hash()); err != nil {
+				return nil
+			}
+		default:
+			return err
+		}
+		switch opt.Strategy {
+		case TagStrategyTaggerDate:
+			cand.date = cand.commit.Committer.When
+			if tag != nil {
+				cand.date = tag.Tagger.When
+			}
+		case TagStrategySemver:
+			v, err := ParseVersion(ref.Name().Short(), opt.Prefix)
+			if err != nil || (v.IsPrerelease() && !opt.IncludePrerelease) {
+				return nil
+			}
+			if constraint != nil && !constraint.Check(v) {
+				return nil
+			}
+			cand.version = &v
+		case TagStrategyNearest:
+			cand.date = cand.commit.Author.When
+			if v, err := ParseVersion(ref.Name().Short(), opt.Prefix); err == nil {
+				cand.version = &v
+			}
+		default:
+			cand.date = cand.commit.Author.When
+		}
+		ret = append(ret, cand)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ref.Name() < ret[j].ref.Name() })
+	return ret, nil
+}
+
+// nearestTag walks the history breadth first and returns the first tagged commit.
+// When several tags point at that commit, the highest version or the last name wins.
+func (c *Client) nearestTag(from string, candidates []tagCandidate) (*plumbing.Reference, error) {
+	start, err := c.resolveCommit(from)
+	if err != nil {
+		return nil, err
+	}
+	byCommit := map[plumbing.Hash][]tagCandidate{}
+	for _, cand := range candidates {
+		byCommit[cand.commit.Hash] = append(byCommit[cand.commit.Hash], cand)
+	}
+	iter := object.NewCommitIterBSF(start, nil, nil)
+	defer iter.Close()
+	for {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			return nil, errors.New("no tag was found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cands, ok := byCommit[commit.Hash]; ok {
+			best := cands[len(cands)-1]
+			for _, cand := range cands {
+				if cand.version != nil && (best.version == nil || cand.version.Compare(*best.version) > 0) {
+					best = cand
+				}
+			}
+			return best.ref, nil
+		}
+	}
+}
+
+type CreateTagOpt struct {
+	// Message makes an annotated tag. An empty message makes a lightweight tag.
+	Message string
+	// Tagger defaults to the author of the client.
+	Tagger *Signature
+	// SignKey signs annotated tags. The private key must be decrypted.
+	SignKey *openpgp.Entity
+	// Force replaces an existing tag.
+	Force bool
+}
+
+type TagInfo struct {
+	Name string `json:"name" yaml:"name"`
+	// Hash is the commit the tag points at.
+	Hash      string     `json:"hash" yaml:"hash"`
+	Annotated bool       `json:"annotated" yaml:"annotated"`
+	TagHash   string     `json:"tagHash,omitempty" yaml:"tagHash,omitempty"`
+	Message   string     `json:"message,omitempty" yaml:"message,omitempty"`
+	Tagger    *Signature `json:"tagger,omitempty" yaml:"tagger,omitempty"`
+	Signed    bool       `json:"signed" yaml:"signed"`
+}
+
+type PushTagsOpt struct {
+	// Names are the tags to push. Empty means all tags.
+	Names []string
+	// Delete removes Names from the remote instead of pushing them.
+	Delete bool
+	// Force overwrites remote tags pointing at other objects.
+	Force bool
+}
+
+func (c *Client) CreateTag(name, rev string, opt CreateTagOpt) (*plumbing.Reference, error) {
+	commit, err := c.resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	refName := plumbing.NewTagReferenceName(name)
+	if _, err := c.r.Storer.Reference(refName); err == nil && !opt.Force {
+		return nil, git.ErrTagExists
+	} else if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+	target := commit.Hash
+	if opt.Message == "" {
+		if opt.SignKey != nil {
+			return nil, errors.New("lightweight tags can not be signed")
+		}
+	} else {
+		tagger := &object.Signature{Name: c.opt.AuthorName, Email: c.opt.AuthorEmail, When: time.Now()}
+		if opt.Tagger != nil {
+			tagger = &object.Signature{Name: opt.Tagger.Name, Email: opt.Tagger.Email, When: opt.Tagger.When}
+		}
+		if target, err = c.tagObject(name, commit, &git.CreateTagOptions{
+			Tagger:  tagger,
+			Message: opt.Message,
+			SignKey: opt.SignKey,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	// a forced tag replaces the old one only after the new one is complete
+	ref := plumbing.NewHashReference(refName, target)
+	if err := c.r.Storer.SetReference(ref); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// tagObject stores an annotated tag of commit like go-git's CreateTag, without touching refs.
+func (c *Client) tagObject(name string, commit *object.Commit, opt *git.CreateTagOptions) (plumbing.Hash, error) {
+	if err := opt.Validate(c.r, commit.Hash); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     *opt.Tagger,
+		Message:    opt.Message,
+		TargetType: plumbing.CommitObject,
+		Target:     commit.Hash,
+	}
+	if opt.SignKey != nil {
+		unsigned := &plumbing.MemoryObject{}
+		if err := tag.Encode(unsigned); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		r, err := unsigned.Reader()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		sig := &bytes.Buffer{}
+		if err := openpgp.ArmoredDetachSign(sig, opt.SignKey, r, nil); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tag.PGPSignature = sig.String()
+	}
+	obj := c.r.Storer.NewEncodedObject()
+	if err := tag.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return c.r.Storer.SetEncodedObject(obj)
+}
+
+func (c *Client) DeleteTag(name string) error {
+	return c.r.DeleteTag(name)
+}
+
+// ListTags returns tags pointing at commits, sorted by name.
+func (c *Client) ListTags() ([]TagInfo, error) {
+	tags, err := c.r.Tags()
+	if err != nil {
+		return nil, err
+	}
+	ret := []TagInfo{}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		info := TagInfo{Name: ref.Name().Short(), Hash: ref.Hash().String()}
+		tag, err := c.r.TagObject(ref.Hash())
+		switch err {
+		case nil:
+			commit, err := tag.Commit()
+			if err == object.ErrUnsupportedObject {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			info.Hash, info.TagHash, info.Annotated = commit.Hash.String(), tag.Hash.String(), true
+			info.Message, info.Signed = tag.Message, tag.PGPSignature != ""
+			info.Tagger = &Signature{Name: tag.Tagger.Name, Email: tag.Tagger.Email, When: tag.Tagger.When}
+		case plumbing.ErrObjectNotFound:
+			if _, err := c.r.CommitObject(ref.Hash()); err != nil {
+				return nil
+			}
+		default:
+			return err
+		}
+		ret = append(ret, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+func (c *Client) PushTags(opt PushTagsOpt) error {
+	if opt.Delete && len(opt.Names) == 0 {
+		return errors.New("tag names are required to delete remote tags")
+	}
+	refSpecs := []config.RefSpec{"refs/tags/*:refs/tags/*"}
+	if len(opt.Names) > 0 {
+		refSpecs = []config.RefSpec{}
+		for _, name := range opt.Names {
+			ref := plumbing.NewTagReferenceName(name)
+			spec := fmt.Sprintf("%s:%s", ref, ref)
+			if opt.Delete {
+				spec = fmt.Sprintf(":%s", ref)
+			}
+			refSpecs = append(refSpecs, config.RefSpec(spec))
+		}
+	}
+	if opt.Force {
+		for i, spec := range refSpecs {
+			if !spec.IsDelete() {
+				refSpecs[i] = "+" + spec
+			}
+		}
+	}
+	if err := c.r.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       c.opt.Auth.AuthMethod,
+		RefSpecs:   refSpecs,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package gtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClient_GetLatestTagReferenceWith(t *testing.T) {
+	// dates increase in this order, so the newest commit is not the highest version.
+	semver := mockWithTags([]string{"v1.10.0", "v2.0.0-rc.1", "v1.9.0", "release"})
+	annotated := mockInit()
+	head, _ := annotated.r.Head()
+	for i, name := range []string{"old", "new", "middle"} {
+		annotated.r.CreateTag(name, head.Hash(), &git.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "bob", Email: "bob@mail.com", When: time.Now().AddDate(0, 0, []int{0, 2, 1}[i])},
+			Message: name,
+		})
+	}
+	nearest := mockWithTags([]string{"v1.0.0", "v1.1.0"})
+	nearest.gitExec([]string{"checkout", "-b", "hotfix", "v1.0.0"})
+	nearest.CommitFiles(map[string][]byte{"fix": []byte("fix")}, "fix")
+	tests := []struct {
+		name    string
+		client  Client
+		opt     LatestTagOpt
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "commit_date",
+			client: semver,
+			opt:    LatestTagOpt{},
+			want:   "release",
+		},
+		{
+			name:   "semver",
+			client: semver,
+			opt:    LatestTagOpt{Strategy: TagStrategySemver, Prefix: "v"},
+			want:   "v1.10.0",
+		},
+		{
+			name:   "semver_prerelease",
+			client: semver,
+			opt:    LatestTagOpt{Strategy: TagStrategySemver, Prefix: "v", IncludePrerelease: true},
+			want:   "v2.0.0-rc.1",
+		},
+		{
+			name:   "semver_constraint",
+			client: semver,
+			opt:    LatestTagOpt{Strategy: TagStrategySemver, Prefix: "v", Constraint: ">=1.2 <1.10"},
+			want:   "v1.9.0",
+		},
+		{
+			name:    "semver_no_match",
+			client:  semver,
+			opt:     LatestTagOpt{Strategy: TagStrategySemver, Constraint: ">=3"},
+			wantErr: true,
+		},
+		{
+			name:   "tagger_date",
+			client: annotated,
+			opt:    LatestTagOpt{Strategy: TagStrategyTaggerDate},
+			want:   "new",
+		},
+		{
+			name:   "nearest",
+			client: nearest,
+			opt:    LatestTagOpt{Strategy: TagStrategyNearest},
+			want:   "v1.0.0",
+		},
+		{
+			name:   "nearest_from",
+			client: nearest,
+			opt:    LatestTagOpt{Strategy: TagStrategyNearest, From: "master"},
+			want:   "v1.1.0",
+		},
+		{
+			name:    "unknown",
+			client:  semver,
+			opt:     LatestTagOpt{Strategy: "unknown"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			got, err := c.GetLatestTagReferenceWith(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.GetLatestTagReferenceWith() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Name() != plumbing.NewTagReferenceName(tt.want) {
+				t.Errorf("Client.GetLatestTagReferenceWith() = %v, want %v", got.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_CreateTag(t *testing.T) {
+	tagger := &Signature{Name: "alice", Email: "alice@mail.com", When: time.Unix(1600000000, 0)}
+	// signing fails after the tag object is built without a private key
+	publicKey, _ := openpgp.NewEntity("alice", "", "alice@mail.com", nil)
+	publicKey.PrivateKey = nil
+	type args struct {
+		name string
+		rev  string
+		opt  CreateTagOpt
+	}
+	tests := []struct {
+		name    string
+		client  Client
+		args    args
+		want    TagInfo
+		wantErr bool
+	}{
+		{
+			name:   "lightweight",
+			client: mockWithTags([]string{"v0.1"}),
+			args:   args{name: "v0.2", rev: "HEAD"},
+			want:   TagInfo{Name: "v0.2"},
+		},
+		{
+			name:   "annotated",
+			client: mockWithTags([]string{"v0.1"}),
+			args:   args{name: "v0.2", rev: "HEAD", opt: CreateTagOpt{Message: "release", Tagger: tagger}},
+			want:   TagInfo{Name: "v0.2", Annotated: true, Message: "release\n", Tagger: tagger},
+		},
+		{
+			name:    "ng_exists",
+			client:  mockWithTags([]string{"v0.1"}),
+			args:    args{name: "v0.1", rev: "HEAD"},
+			wantErr: true,
+		},
+		{
+			name:   "force",
+			client: mockWithTags([]string{"v0.1"}),
+			args:   args{name: "v0.1", rev: "HEAD", opt: CreateTagOpt{Force: true, Message: "again", Tagger: tagger}},
+			want:   TagInfo{Name: "v0.1", Annotated: true, Message: "again\n", Tagger: tagger},
+		},
+		{
+			name:    "ng_force_keeps_tag",
+			client:  mockWithTags([]string{"v0.1"}),
+			args:    args{name: "v0.1", rev: "HEAD", opt: CreateTagOpt{Force: true, Message: "again", Tagger: tagger, SignKey: publicKey}},
+			want:    TagInfo{Name: "v0.1"},
+			wantErr: true,
+		},
+		{
+			name:    "ng_revision",
+			client:  mockInit(),
+			args:    args{name: "v0.1", rev: "no-rev"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			_, err := c.CreateTag(tt.args.name, tt.args.rev, tt.args.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.CreateTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && tt.want.Name == "" {
+				return
+			}
+			tags, err := c.ListTags()
+			if err != nil {
+				t.Errorf("Client.ListTags() error = %v", err)
+				return
+			}
+			head, _ := c.GetHash("master", false)
+			for _, got := range tags {
+				if got.Name != tt.want.Name {
+					continue
+				}
+				tt.want.Hash, tt.want.TagHash = head, got.TagHash
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("Client.ListTags() mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
+			t.Errorf("tag %s was not found in %v", tt.want.Name, tags)
+		})
+	}
+}
+
+func TestClient_DeleteTag(t *testing.T) {
+	c := mockWithTags([]string{"v0.1", "v0.2"})
+	if err := c.DeleteTag("v0.1"); err != nil {
+		t.Errorf("Client.DeleteTag() error = %v", err)
+	}
+	if err := c.DeleteTag("v0.1"); err == nil {
+		t.Errorf("Client.DeleteTag() should fail for a missing tag")
+	}
+	tags, _ := c.ListTags()
+	if len(tags) != 1 || tags[0].Name != "v0.2" {
+		t.Errorf("Client.ListTags() = %v, want only v0.2", tags)
+	}
+}
+
+func TestClient_PushTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     PushTagsOpt
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all",
+			opt:  PushTagsOpt{},
+			want: []string{"v0.1", "v0.2"},
+		},
+		{
+			name: "selected",
+			opt:  PushTagsOpt{Names: []string{"v0.2"}},
+			want: []string{"v0.2"},
+		},
+		{
+			name: "delete",
+			opt:  PushTagsOpt{Names: []string{"remote"}, Delete: true},
+			want: []string{},
+		},
+		{
+			name:    "ng_delete_without_names",
+			opt:     PushTagsOpt{Delete: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewMock(MockOpt{
+				CurrentBranch: "master",
+				Remote: &MockOpt{
+					CurrentBranch: "master",
+					Commits:       []MockCommit{{Message: "init", Files: map[string][]byte{"file": {0}}}},
+				},
+			})
+			m.RC.CreateTag("remote", "HEAD", CreateTagOpt{})
+			c := m.C
+			c.CreateTag("v0.1", "HEAD", CreateTagOpt{})
+			c.CreateTag("v0.2", "HEAD", CreateTagOpt{Message: "v0.2"})
+			if err := c.PushTags(tt.opt); (err != nil) != tt.wantErr {
+				t.Errorf("Client.PushTags() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			tags, _ := m.RC.ListTags()
+			got := []string{}
+			for _, tag := range tags {
+				if tag.Name != "remote" || tt.opt.Delete {
+					got = append(got, tag.Name)
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("remote tags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
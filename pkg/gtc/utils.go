@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -58,107 +57,32 @@ func (c *Client) GetHash(base string, referRemote bool) (string, error) {
 }
 
 func (c *Client) GetLatestTagReference(referRemote bool) (*plumbing.Reference, error) {
-	if referRemote {
-		if err := c.Fetch(); err != nil {
-			return nil, errors.Wrap(err, "failed to fetch")
-		}
-		w, err := c.r.Worktree()
-		if err != nil {
-			return nil, err
-		}
-		if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewRemoteReferenceName("origin", c.opt.Revision), Force: true}); err != nil {
-			return nil, errors.Wrap(err, "failed to checkout remote branch")
-		}
-	}
-	tags, err := c.r.Tags()
-	if err != nil {
-		return nil, err
-	}
-	latestTagDate := time.Unix(0, 0)
-	var latestTagReference *plumbing.Reference = nil
-	err = tags.ForEach(func(ref *plumbing.Reference) error {
-		commit, err := c.r.CommitObject(ref.Hash())
-		if err != nil {
-			return err
-		}
-		if latestTagDate.Before(commit.Author.When) {
-			latestTagDate = commit.Author.When
-			latestTagReference = ref
-		}
-		return nil
+	return c.GetLatestTagReferenceWith(LatestTagOpt{
+		Strategy:    TagStrategyCommitDate,
+		ReferRemote: referRemote,
 	})
-	if err != nil {
-		return nil, err
-	}
-	if latestTagReference == nil {
-		return nil, errors.New("no tag was found")
-	}
-	return latestTagReference, nil
 }
 
+// ReadFiles reads files under paths, skipping files whose name contains one of ignoreFile
+// and directories named one of ignoreDir.
 func (c *Client) ReadFiles(paths, ignoreFile, ignoreDir []string, absolutePath bool) (map[string][]byte, error) {
-	result := map[string][]byte{}
-	for _, path := range paths {
-		buf, err := readFiles(fmt.Sprintf("%s/%s", c.opt.DirPath, path), ignoreFile, ignoreDir)
-		if err != nil {
-			return nil, err
-		}
-		for k, v := range buf {
-			if absolutePath {
-				result[k] = v
-			} else {
-				result[strings.Replace(k, fmt.Sprintf("%s/", c.opt.DirPath), "", -1)] = v
-			}
-		}
-	}
-	return result, nil
-}
-
-func readFiles(path string, ignoreFile, ignoreDir []string) (map[string][]byte, error) {
-	if ignoreFile == nil {
-		ignoreFile = []string{}
-	}
-	if ignoreDir == nil {
-		ignoreDir = []string{}
-	}
-	ret := map[string][]byte{}
-	s, err := os.Stat(path)
-	if err != nil {
-		return ret, nil
-	}
-	if !s.IsDir() {
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			return nil, err
-		}
-		ret[path] = b
-		return ret, nil
-	}
-	err = filepath.Walk(path, func(path string, info os.FileInfo, e error) error {
-		if info.IsDir() {
-			for _, s := range ignoreDir {
-				if info.Name() == s {
-					return filepath.SkipDir
-				}
+	skip := func(name string, dir bool) bool {
+		for _, s := range ignoreDir {
+			if dir && name == s {
+				return true
 			}
-			return nil
 		}
 		for _, s := range ignoreFile {
-			if strings.Contains(info.Name(), s) {
-				return nil
+			if !dir && strings.Contains(name, s) {
+				return true
 			}
 		}
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		ret[path] = b
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		return false
 	}
-	return ret, nil
+	opt := WalkOpt{ReadFilesOpt: ReadFilesOpt{Paths: paths, AbsolutePath: absolutePath}}
+	return readEntries(func(fn func(FileEntry) error) error {
+		return c.walkFiles(opt, skip, fn)
+	})
 }
 
 func (c *Client) AddClientAsSubmodule(name string, subc Client) error {